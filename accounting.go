@@ -0,0 +1,188 @@
+package main
+
+import (
+	"sync"
+
+	apipb "code.vegaprotocol.io/vega/protos/data-node/api/v2"
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	"github.com/shopspring/decimal"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// how many epochs of history we keep
+const maxAccountingEpochs = 100
+
+// EpochAccounting is what our liquidity provision earned
+// and lost during an epoch, all amounts are in asset precision.
+type EpochAccounting struct {
+	Epoch uint64
+	// gross fees, before the fee penalties
+	FeesEarned       decimal.Decimal
+	PerformanceBonus decimal.Decimal
+	FeePenalties     decimal.Decimal
+	BondPenalties    decimal.Decimal
+	Net              decimal.Decimal
+}
+
+func (e *EpochAccounting) add(o *EpochAccounting) {
+	e.FeesEarned = e.FeesEarned.Add(o.FeesEarned)
+	e.PerformanceBonus = e.PerformanceBonus.Add(o.PerformanceBonus)
+	e.FeePenalties = e.FeePenalties.Add(o.FeePenalties)
+	e.BondPenalties = e.BondPenalties.Add(o.BondPenalties)
+	e.Net = e.Net.Add(o.Net)
+}
+
+// LPAccounting accumulates per epoch the liquidity fees, bonuses
+// and penalties of our party on the market, from the ledger entries.
+type LPAccounting struct {
+	pubkey string
+	market string
+
+	mu sync.RWMutex
+	// map[epoch]EpochAccounting
+	epochs map[uint64]*EpochAccounting
+	totals EpochAccounting
+}
+
+func NewLPAccounting(pubkey, market string) *LPAccounting {
+	return &LPAccounting{
+		pubkey: pubkey,
+		market: market,
+		epochs: map[uint64]*EpochAccounting{},
+	}
+}
+
+// epochStarts are the start times of the epochs seen so far, used to
+// find out during which epoch a ledger entry happened.
+// map[epoch]startTime
+type epochStarts map[uint64]int64
+
+// epochAt returns the latest epoch started at or before the
+// timestamp, false if it started before all the known epochs.
+func (e epochStarts) epochAt(ts int64) (uint64, bool) {
+	var (
+		seq   uint64
+		found bool
+	)
+	for s, start := range e {
+		if start <= ts && (!found || s > seq) {
+			seq, found = s, true
+		}
+	}
+	return seq, found
+}
+
+// OnLedgerEntries accounts for the entries, each one is attributed
+// to the epoch during which it happened.
+func (a *LPAccounting) OnLedgerEntries(
+	epochs epochStarts,
+	entries []*apipb.AggregatedLedgerEntry,
+) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, e := range entries {
+		if e.GetFromAccountMarketId() != a.market && e.GetToAccountMarketId() != a.market {
+			continue
+		}
+
+		amount, err := decimal.NewFromString(e.Quantity)
+		if err != nil {
+			continue
+		}
+
+		seq, ok := epochs.epochAt(e.Timestamp)
+		if !ok {
+			continue
+		}
+
+		delta := &EpochAccounting{}
+		incoming := e.GetToAccountPartyId() == a.pubkey
+		outgoing := e.GetFromAccountPartyId() == a.pubkey
+
+		switch e.TransferType {
+		case vegapb.TransferType_TRANSFER_TYPE_LIQUIDITY_FEE_ALLOCATE:
+			// the gross fees, the penalties are taken from them afterwards
+			// and what's left is moved to our general account, which is
+			// only a transfer between our own accounts
+			if !incoming {
+				continue
+			}
+			delta.FeesEarned = amount
+			delta.Net = amount
+		case vegapb.TransferType_TRANSFER_TYPE_SLA_PERFORMANCE_BONUS_DISTRIBUTE:
+			if !incoming {
+				continue
+			}
+			delta.PerformanceBonus = amount
+			delta.Net = amount
+		case vegapb.TransferType_TRANSFER_TYPE_SLA_PENALTY_LP_FEE_APPLY,
+			vegapb.TransferType_TRANSFER_TYPE_LIQUIDITY_FEE_UNPAID_COLLECT:
+			if !outgoing {
+				continue
+			}
+			delta.FeePenalties = amount
+			delta.Net = amount.Neg()
+		case vegapb.TransferType_TRANSFER_TYPE_SLA_PENALTY_BOND_APPLY,
+			vegapb.TransferType_TRANSFER_TYPE_BOND_SLASHING:
+			if !outgoing {
+				continue
+			}
+			delta.BondPenalties = amount
+			delta.Net = amount.Neg()
+		default:
+			continue
+		}
+
+		acc, ok := a.epochs[seq]
+		if !ok {
+			acc = &EpochAccounting{Epoch: seq}
+			a.epochs[seq] = acc
+		}
+		acc.add(delta)
+		a.totals.add(delta)
+	}
+
+	// forget about the oldest epochs
+	if len(a.epochs) > maxAccountingEpochs {
+		seqs := maps.Keys(a.epochs)
+		slices.Sort(seqs)
+		for _, s := range seqs[:len(seqs)-maxAccountingEpochs] {
+			delete(a.epochs, s)
+		}
+	}
+}
+
+// Totals returns the amounts accumulated since the start
+// of the epoch during which the bot started.
+func (a *LPAccounting) Totals() EpochAccounting {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.totals
+}
+
+// History returns the amounts per epoch, oldest first.
+func (a *LPAccounting) History() []EpochAccounting {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	out := make([]EpochAccounting, 0, len(a.epochs))
+	for _, e := range a.epochs {
+		out = append(out, *e)
+	}
+	slices.SortFunc(out, func(a, b EpochAccounting) bool {
+		return a.Epoch < b.Epoch
+	})
+	return out
+}
+
+// ledgerTransferTypes are the transfers relevant to the liquidity provision.
+var ledgerTransferTypes = []vegapb.TransferType{
+	vegapb.TransferType_TRANSFER_TYPE_LIQUIDITY_FEE_ALLOCATE,
+	vegapb.TransferType_TRANSFER_TYPE_SLA_PERFORMANCE_BONUS_DISTRIBUTE,
+	vegapb.TransferType_TRANSFER_TYPE_SLA_PENALTY_LP_FEE_APPLY,
+	vegapb.TransferType_TRANSFER_TYPE_LIQUIDITY_FEE_UNPAID_COLLECT,
+	vegapb.TransferType_TRANSFER_TYPE_SLA_PENALTY_BOND_APPLY,
+	vegapb.TransferType_TRANSFER_TYPE_BOND_SLASHING,
+}
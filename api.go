@@ -2,9 +2,13 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
 
 	apipb "code.vegaprotocol.io/vega/protos/data-node/api/v2"
 	vegapb "code.vegaprotocol.io/vega/protos/vega"
@@ -20,25 +24,149 @@ type State struct {
 	Orders     []*vegapb.Order
 	Accounts   []*apipb.AccountBalance
 	Assets     []*vegapb.Asset
+	// data node streams waiting to be resynced
+	StaleStreams []string
+	// how far behind the wall clock the vega data is
+	DataLag time.Duration
+	// our current and pending liquidity provisions
+	LiquidityProvision        *vegapb.LiquidityProvision
+	PendingLiquidityProvision *vegapb.LiquidityProvision
+	// top of the vega book, in market precision
+	Depth Book
+	// quote levels moved or dropped because of
+	// the market price monitoring bounds
+	ClampedLevels []ClampedLevel
+	// transactions sent and rejected orders
+	Transactions TxStats
+	// orders and fills per quote level
+	Levels []LevelStats
+	// usage of the spam protection budget
+	Spam SpamStats
+	// liquidity commitment obligations
+	SLA SLAStatus
+	// funding of perpetual markets
+	Funding FundingStatus
+	// operator commands
+	Control ControlStatus
+	// fees earned and penalties paid by our
+	// liquidity provision, in asset precision
+	LPAccounting EpochAccounting
 }
 
-func StartAPI(config *Config, vega *VegaStore, refPrice *BinanceRP) {
-	http.HandleFunc("/state", func(w http.ResponseWriter, r *http.Request) {
-		bid, ask := refPrice.Get()
-		state := State{
-			Position:   vega.GetPosition(),
-			Market:     vega.GetMarket(),
-			MarketData: vega.GetMarketData(),
-			Orders:     vega.GetOrders(),
-			Accounts:   vega.GetAccounts(),
-			BestBid:    bid,
-			BestAsk:    ask,
-			Assets:     vega.GetAssets(),
+type LPAccountingState struct {
+	Totals  EpochAccounting
+	History []EpochAccounting
+}
+
+// BotState is returned by the /state endpoint, with one
+// section per key and market.
+type BotState struct {
+	// health of the data nodes we can fail over to
+	DataNodes []DataNodeStatus
+	// map[pubkey]map[market]State
+	Keys map[string]map[string]State
+}
+
+func (m *MarketBot) State() State {
+	bid, ask := m.refPrice.Get()
+	return State{
+		Position:   m.vega.GetPosition(),
+		Market:     m.vega.GetMarket(),
+		MarketData: m.vega.GetMarketData(),
+		Orders:     m.vega.GetOrders(),
+		Accounts:   m.vega.GetAccounts(),
+		BestBid:    bid,
+		BestAsk:    ask,
+		Assets:     m.vega.GetAssets(),
+
+		StaleStreams: m.vega.GetStale(),
+		DataLag:      m.vega.GetDataLag(time.Now(), m.nodes.VegaTime()),
+
+		LiquidityProvision:        m.vega.GetLiquidityProvison(),
+		PendingLiquidityProvision: m.vega.GetPendingLiquidityProvision(),
+
+		Depth: m.vega.GetMarketDepth(stateBookDepth),
+
+		ClampedLevels: m.strategy.GetClampedLevels(),
+		Transactions:  m.tracker.Stats(),
+		Levels:        m.tracker.LevelStats(),
+		Spam:          m.sender.Stats(),
+		SLA:           m.strategy.GetSLAStatus(),
+		Funding:       m.strategy.GetFundingStatus(),
+		Control:       m.strategy.GetControlStatus(),
+		LPAccounting:  m.accounting.Totals(),
+	}
+}
+
+// StartAPI serves the state API in the background,
+// the returned server must be shut down on exit.
+func StartAPI(config *Config, nodes *DataNodePool, bots map[string]map[string]*MarketBot) *http.Server {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/state", func(w http.ResponseWriter, r *http.Request) {
+		state := BotState{
+			DataNodes: nodes.Status(),
+			Keys:      map[string]map[string]State{},
+		}
+		for pubkey, markets := range bots {
+			state.Keys[pubkey] = map[string]State{}
+			for id, bot := range markets {
+				state.Keys[pubkey][id] = bot.State()
+			}
+		}
+
+		out, _ := json.Marshal(&state)
+		fmt.Fprintf(w, "%v", string(out))
+	})
+
+	mux.HandleFunc("/accounting", func(w http.ResponseWriter, r *http.Request) {
+		state := map[string]map[string]LPAccountingState{}
+		for pubkey, markets := range bots {
+			state[pubkey] = map[string]LPAccountingState{}
+			for id, bot := range markets {
+				state[pubkey][id] = LPAccountingState{
+					Totals:  bot.accounting.Totals(),
+					History: bot.accounting.History(),
+				}
+			}
 		}
 
 		out, _ := json.Marshal(&state)
 		fmt.Fprintf(w, "%v", string(out))
 	})
 
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	mux.HandleFunc("/fills", func(w http.ResponseWriter, r *http.Request) {
+		fills := map[string]map[string][]Fill{}
+		for pubkey, markets := range bots {
+			fills[pubkey] = map[string][]Fill{}
+			for id, bot := range markets {
+				fills[pubkey][id] = bot.vega.GetFills()
+			}
+		}
+
+		out, _ := json.Marshal(&fills)
+		fmt.Fprintf(w, "%v", string(out))
+	})
+
+	for _, command := range []string{controlPause, controlResume, controlCancelAll, controlFlatten} {
+		mux.HandleFunc("/control/"+command, controlHandler(config, bots, command))
+	}
+
+	mux.HandleFunc("/params", paramsHandler(config, bots))
+
+	server := &http.Server{
+		Addr:         net.JoinHostPort(config.APIHost, strconv.Itoa(int(config.APIPort))),
+		Handler:      mux,
+		ReadTimeout:  config.APIReadTimeout,
+		WriteTimeout: config.APIWriteTimeout,
+	}
+
+	go func() {
+		log.Printf("state API listening on %v", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("state API failed: %v", err)
+		}
+	}()
+
+	return server
 }
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	commandspb "code.vegaprotocol.io/vega/protos/vega/commands/v1"
+	"github.com/shopspring/decimal"
+	"golang.org/x/exp/slices"
+)
+
+// how many levels per side are returned by the /state endpoint
+const stateBookDepth = 10
+
+// BookLevel is a price level of the vega book, in market precision.
+type BookLevel struct {
+	Price  decimal.Decimal
+	Volume uint64
+	Orders uint64
+}
+
+// Book is a snapshot of the vega book, best levels first.
+type Book struct {
+	Sequence uint64
+	Bids     []BookLevel
+	Asks     []BookLevel
+}
+
+func (b Book) BestBid() (BookLevel, bool) {
+	if len(b.Bids) <= 0 {
+		return BookLevel{}, false
+	}
+	return b.Bids[0], true
+}
+
+func (b Book) BestAsk() (BookLevel, bool) {
+	if len(b.Asks) <= 0 {
+		return BookLevel{}, false
+	}
+	return b.Asks[0], true
+}
+
+// l2Book is the market depth built from the snapshot and the updates
+// streamed by the data node, it's not safe for concurrent use.
+type l2Book struct {
+	sequence uint64
+	// map[price]PriceLevel
+	bids map[string]*vegapb.PriceLevel
+	asks map[string]*vegapb.PriceLevel
+}
+
+func newL2Book(sequence uint64, buy, sell []*vegapb.PriceLevel) *l2Book {
+	b := &l2Book{
+		sequence: sequence,
+		bids:     map[string]*vegapb.PriceLevel{},
+		asks:     map[string]*vegapb.PriceLevel{},
+	}
+	b.setLevels(b.bids, buy)
+	b.setLevels(b.asks, sell)
+	return b
+}
+
+// apply updates the book, an error is returned if some updates were
+// missed, in which case the book must be reloaded from a snapshot.
+func (b *l2Book) apply(u *vegapb.MarketDepthUpdate) error {
+	// sent before the snapshot we loaded
+	if u.SequenceNumber <= b.sequence {
+		return nil
+	}
+
+	if u.PreviousSequenceNumber != b.sequence {
+		return fmt.Errorf("market depth sequence gap, expected %v, got %v",
+			b.sequence, u.PreviousSequenceNumber)
+	}
+
+	b.setLevels(b.bids, u.Buy)
+	b.setLevels(b.asks, u.Sell)
+	b.sequence = u.SequenceNumber
+	return nil
+}
+
+func (b *l2Book) setLevels(side map[string]*vegapb.PriceLevel, levels []*vegapb.PriceLevel) {
+	for _, l := range levels {
+		if l.Volume == 0 {
+			delete(side, l.Price)
+			continue
+		}
+		side[l.Price] = l
+	}
+}
+
+// snapshot returns up to depth levels per side, all of them if depth is 0.
+func (b *l2Book) snapshot(depth int) Book {
+	return Book{
+		Sequence: b.sequence,
+		Bids:     sortedLevels(b.bids, depth, true),
+		Asks:     sortedLevels(b.asks, depth, false),
+	}
+}
+
+func sortedLevels(side map[string]*vegapb.PriceLevel, depth int, descending bool) []BookLevel {
+	out := make([]BookLevel, 0, len(side))
+	for _, l := range side {
+		price, err := decimal.NewFromString(l.Price)
+		if err != nil {
+			continue
+		}
+		out = append(out, BookLevel{Price: price, Volume: l.Volume, Orders: l.NumberOfOrders})
+	}
+
+	slices.SortFunc(out, func(a, b BookLevel) bool {
+		if descending {
+			return a.Price.GreaterThan(b.Price)
+		}
+		return a.Price.LessThan(b.Price)
+	})
+
+	if depth > 0 && len(out) > depth {
+		out = out[:depth]
+	}
+	return out
+}
+
+// logBookPosition logs where our best quotes sit compared
+// to the top of the vega book, which includes our current orders.
+func logBookPosition(book Book, bids, asks []*commandspb.OrderSubmission) {
+	best := func(orders []*commandspb.OrderSubmission, higher bool) (decimal.Decimal, bool) {
+		var (
+			out decimal.Decimal
+			ok  bool
+		)
+		for _, o := range orders {
+			price, err := decimal.NewFromString(o.Price)
+			if err != nil {
+				continue
+			}
+			if !ok || (higher && price.GreaterThan(out)) || (!higher && price.LessThan(out)) {
+				out, ok = price, true
+			}
+		}
+		return out, ok
+	}
+
+	if top, ok := book.BestBid(); ok {
+		if ours, ok := best(bids, true); ok {
+			log.Printf("vega best bid %v, our best bid %v (%v from the top)", top.Price, ours, top.Price.Sub(ours))
+		}
+	}
+	if top, ok := book.BestAsk(); ok {
+		if ours, ok := best(asks, false); ok {
+			log.Printf("vega best ask %v, our best ask %v (%v from the top)", top.Price, ours, ours.Sub(top.Price))
+		}
+	}
+}
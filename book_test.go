@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+)
+
+func testLevels(levels ...testOrder) []*vegapb.PriceLevel {
+	out := []*vegapb.PriceLevel{}
+	for _, l := range levels {
+		out = append(out, &vegapb.PriceLevel{Price: l.price, Volume: l.size, NumberOfOrders: 1})
+	}
+	return out
+}
+
+func testDepthUpdate(seq, previous uint64, buy, sell []*vegapb.PriceLevel) *vegapb.MarketDepthUpdate {
+	return &vegapb.MarketDepthUpdate{
+		SequenceNumber:         seq,
+		PreviousSequenceNumber: previous,
+		Buy:                    buy,
+		Sell:                   sell,
+	}
+}
+
+func TestL2BookApply(t *testing.T) {
+	cases := []struct {
+		name     string
+		updates  []*vegapb.MarketDepthUpdate
+		gap      bool
+		sequence uint64
+		bids     []testOrder
+		asks     []testOrder
+	}{
+		{
+			"update older than the snapshot ignored",
+			[]*vegapb.MarketDepthUpdate{testDepthUpdate(9, 8, testLevels(testOrder{"101", 1}), nil)},
+			false, 10, []testOrder{{"100", 5}}, []testOrder{{"110", 5}},
+		},
+		{
+			"level added",
+			[]*vegapb.MarketDepthUpdate{testDepthUpdate(11, 10, testLevels(testOrder{"101", 2}), nil)},
+			false, 11, []testOrder{{"101", 2}, {"100", 5}}, []testOrder{{"110", 5}},
+		},
+		{
+			"level updated",
+			[]*vegapb.MarketDepthUpdate{testDepthUpdate(11, 10, nil, testLevels(testOrder{"110", 3}))},
+			false, 11, []testOrder{{"100", 5}}, []testOrder{{"110", 3}},
+		},
+		{
+			"level removed",
+			[]*vegapb.MarketDepthUpdate{testDepthUpdate(11, 10, testLevels(testOrder{"100", 0}), nil)},
+			false, 11, []testOrder{}, []testOrder{{"110", 5}},
+		},
+		{
+			"consecutive updates",
+			[]*vegapb.MarketDepthUpdate{
+				testDepthUpdate(11, 10, nil, testLevels(testOrder{"105", 1})),
+				testDepthUpdate(12, 11, nil, testLevels(testOrder{"110", 0})),
+			},
+			false, 12, []testOrder{{"100", 5}}, []testOrder{{"105", 1}},
+		},
+		{
+			"gap after the snapshot",
+			[]*vegapb.MarketDepthUpdate{testDepthUpdate(12, 11, testLevels(testOrder{"101", 1}), nil)},
+			true, 10, []testOrder{{"100", 5}}, []testOrder{{"110", 5}},
+		},
+		{
+			"gap between updates",
+			[]*vegapb.MarketDepthUpdate{
+				testDepthUpdate(11, 10, testLevels(testOrder{"101", 1}), nil),
+				testDepthUpdate(13, 12, testLevels(testOrder{"102", 1}), nil),
+			},
+			true, 11, []testOrder{{"101", 1}, {"100", 5}}, []testOrder{{"110", 5}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b := newL2Book(10, testLevels(testOrder{"100", 5}), testLevels(testOrder{"110", 5}))
+
+			var err error
+			for _, u := range c.updates {
+				if err = b.apply(u); err != nil {
+					break
+				}
+			}
+			if gap := err != nil; gap != c.gap {
+				t.Errorf("expected gap %v, got %v", c.gap, err)
+			}
+
+			book := b.snapshot(0)
+			if book.Sequence != c.sequence {
+				t.Errorf("expected sequence %v, got %v", c.sequence, book.Sequence)
+			}
+			checkLevels(t, "bids", book.Bids, c.bids)
+			checkLevels(t, "asks", book.Asks, c.asks)
+		})
+	}
+}
+
+func checkLevels(t *testing.T, side string, got []BookLevel, expected []testOrder) {
+	t.Helper()
+
+	if len(got) != len(expected) {
+		t.Fatalf("%v: expected %v levels, got %v", side, len(expected), len(got))
+	}
+	for i, l := range got {
+		if l.Price.String() != expected[i].price || l.Volume != expected[i].size {
+			t.Errorf("%v level %v: expected %v, got %v@%v", side, i, expected[i], l.Volume, l.Price)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"log"
+
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	"github.com/shopspring/decimal"
+)
+
+// priceBounds is the tightest valid price range across all the price
+// monitoring triggers of a market, expressed in market precision.
+type priceBounds struct {
+	min decimal.Decimal
+	max decimal.Decimal
+	// set to false if the market have no price monitoring bounds
+	// at the moment (e.g: during an auction)
+	ok bool
+}
+
+// ClampedLevel reports a quote level which price was moved
+// inside, or dropped because of, the price monitoring bounds.
+type ClampedLevel struct {
+	Side         string
+	Level        int
+	Price        string
+	ClampedPrice string
+	Dropped      bool
+}
+
+func getPriceBounds(md *vegapb.MarketData) (b priceBounds) {
+	for _, v := range md.GetPriceMonitoringBounds() {
+		min, err := decimal.NewFromString(v.MinValidPrice)
+		if err != nil {
+			continue
+		}
+		max, err := decimal.NewFromString(v.MaxValidPrice)
+		if err != nil {
+			continue
+		}
+
+		if !b.ok || min.GreaterThan(b.min) {
+			b.min = min
+		}
+		if !b.ok || max.LessThan(b.max) {
+			b.max = max
+		}
+		b.ok = true
+	}
+
+	return b
+}
+
+// AlignToTick shrinks the bounds to the closest prices
+// aligned on the market tick size.
+func (b priceBounds) AlignToTick(d decimals) priceBounds {
+	if !b.ok {
+		return b
+	}
+
+	b.min = d.AlignToTick(b.min, true)
+	b.max = d.AlignToTick(b.max, false)
+	return b
+}
+
+// Clamp returns the price moved inside the bounds, a bid above the
+// maximum or an offer below the minimum cannot be moved without
+// crossing the range so it needs to be dropped.
+func (b priceBounds) Clamp(
+	side vegapb.Side, price decimal.Decimal,
+) (clamped decimal.Decimal, drop bool) {
+	if !b.ok {
+		return price, false
+	}
+
+	switch side {
+	case vegapb.Side_SIDE_BUY:
+		if price.GreaterThan(b.max) {
+			return price, true
+		}
+		if price.LessThan(b.min) {
+			return b.min, false
+		}
+	case vegapb.Side_SIDE_SELL:
+		if price.LessThan(b.min) {
+			return price, true
+		}
+		if price.GreaterThan(b.max) {
+			return b.max, false
+		}
+	}
+
+	return price, false
+}
+
+func logClampedLevels(levels []ClampedLevel) {
+	for _, l := range levels {
+		if l.Dropped {
+			log.Printf("%v level %v dropped, price %v outside of price monitoring bounds", l.Side, l.Level, l.Price)
+			continue
+		}
+		log.Printf("%v level %v clamped to price monitoring bounds: %v -> %v", l.Side, l.Level, l.Price, l.ClampedPrice)
+	}
+}
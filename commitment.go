@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// commit a fixed amount
+	commitmentPolicyFixed = "fixed"
+	// commit a fraction of our balance for the market asset
+	commitmentPolicyBalance = "balance"
+	// commit enough to own a share of the total market commitment
+	commitmentPolicyMarketShare = "market-share"
+)
+
+// CommitmentPolicy decides how much we commit to the liquidity of the market.
+// All the amounts are expressed in asset units, not in asset precision.
+type CommitmentPolicy struct {
+	Policy      string
+	Amount      decimal.Decimal
+	Fraction    decimal.Decimal
+	MarketShare decimal.Decimal
+	// bounds applied on the commitment,
+	// zero means no bound
+	Min decimal.Decimal
+	Max decimal.Decimal
+}
+
+func NewCommitmentPolicy(config *Config) CommitmentPolicy {
+	parse := func(v string) decimal.Decimal {
+		if len(v) <= 0 {
+			return decimal.Zero
+		}
+		return decimal.RequireFromString(v)
+	}
+
+	return CommitmentPolicy{
+		Policy:      config.CommitmentPolicy,
+		Amount:      parse(config.CommitmentAmount),
+		Fraction:    parse(config.CommitmentFraction),
+		MarketShare: parse(config.CommitmentMarketShare),
+		Min:         parse(config.CommitmentMin),
+		Max:         parse(config.CommitmentMax),
+	}
+}
+
+// Commitment returns the commitment amount to use for the market,
+// in asset precision.
+func (p CommitmentPolicy) Commitment(
+	vega *VegaStore,
+	pubkey, market string,
+) (decimal.Decimal, error) {
+	mkt := vega.GetMarket()
+	if mkt == nil {
+		return decimal.Zero, errors.New("market not loaded")
+	}
+
+	asset := vega.GetAsset(getSettlementAsset(mkt))
+	if asset == nil {
+		return decimal.Zero, errors.New("settlement asset not loaded")
+	}
+
+	assetFactor := decimal.NewFromInt(10).Pow(decimal.NewFromInt(int64(asset.Details.Decimals)))
+	balance := getAssetBalance(vega, pubkey, market)
+	if balance.IsZero() {
+		return decimal.Zero, fmt.Errorf("no balance for asset %v, please deposit funds first", asset.Details.Symbol)
+	}
+
+	var commitment decimal.Decimal
+	switch p.Policy {
+	case commitmentPolicyFixed:
+		commitment = p.Amount.Mul(assetFactor)
+	case commitmentPolicyBalance:
+		commitment = balance.Mul(p.Fraction)
+	case commitmentPolicyMarketShare:
+		commitment = p.marketShareCommitment(vega)
+	default:
+		return decimal.Zero, fmt.Errorf("unknown commitment policy %v", p.Policy)
+	}
+
+	if p.Min.IsPositive() && commitment.LessThan(p.Min.Mul(assetFactor)) {
+		commitment = p.Min.Mul(assetFactor)
+	}
+	if p.Max.IsPositive() && commitment.GreaterThan(p.Max.Mul(assetFactor)) {
+		commitment = p.Max.Mul(assetFactor)
+	}
+
+	if minimum := getMinimumCommitment(vega, asset); commitment.LessThan(minimum) {
+		log.Printf("commitment %v below the market minimum %v, using the minimum", commitment.Truncate(0), minimum)
+		commitment = minimum
+	}
+
+	if commitment.GreaterThan(balance) {
+		return decimal.Zero, fmt.Errorf("commitment %v greater than our balance %v", commitment.Truncate(0), balance)
+	}
+
+	return commitment.Truncate(0), nil
+}
+
+// marketShareCommitment returns the commitment which would give us the target
+// share of the total stake supplied to the market:
+// ours / (others + ours) = share => ours = share * others / (1 - share)
+func (p CommitmentPolicy) marketShareCommitment(vega *VegaStore) decimal.Decimal {
+	supplied, err := decimal.NewFromString(vega.GetMarketData().GetSuppliedStake())
+	if err != nil {
+		return decimal.Zero
+	}
+
+	others := supplied
+	if lp := vega.GetLiquidityProvison(); lp != nil {
+		if ours, err := decimal.NewFromString(lp.CommitmentAmount); err == nil {
+			others = others.Sub(ours)
+		}
+	}
+
+	one := decimal.NewFromInt(1)
+	if !others.IsPositive() || p.MarketShare.GreaterThanOrEqual(one) {
+		return decimal.Zero
+	}
+
+	return others.Mul(p.MarketShare).Div(one.Sub(p.MarketShare))
+}
+
+// getMinimumCommitment returns the smallest commitment accepted by
+// the network for the asset, in asset precision.
+func getMinimumCommitment(vega *VegaStore, asset *vegapb.Asset) decimal.Decimal {
+	multiple, ok := vega.GetNetworkParameter(netParamMinLpStakeQuantumMultiple)
+	if !ok {
+		return decimal.Zero
+	}
+
+	m, err := decimal.NewFromString(multiple)
+	if err != nil {
+		return decimal.Zero
+	}
+
+	quantum, err := decimal.NewFromString(asset.Details.Quantum)
+	if err != nil {
+		return decimal.Zero
+	}
+
+	return m.Mul(quantum)
+}
@@ -4,10 +4,24 @@ import (
 	"flag"
 	"log"
 	"os"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
 )
 
+// MarketConfig is a market pair traded by the bot,
+// with the key and the strategy used to trade it.
+type MarketConfig struct {
+	VegaMarket    string
+	BinanceMarket string
+	TickSize      string
+	WalletPubkey  string
+	Strategy      string
+}
+
 type Config struct {
-	VegaGRPCURL   string
+	VegaGRPCURLs  []string
 	WalletURL     string
 	BinanceWSURL  string
 	WalletToken   string
@@ -15,6 +29,54 @@ type Config struct {
 	VegaMarket    string
 	BinanceMarket string
 	LPFee         string
+	TickSize      string
+	BotID         string
+	Strategy      string
+
+	APIHost         string
+	APIPort         uint
+	APIReadTimeout  time.Duration
+	APIWriteTimeout time.Duration
+	// required by the control endpoints
+	APIToken string
+
+	// all the market pairs traded by the bot, VegaMarket, BinanceMarket
+	// and TickSize are the ones of the market being run, see ForMarket
+	Markets []MarketConfig
+
+	VegaTLS     bool
+	VegaTLSCA   string
+	VegaTLSCert string
+	VegaTLSKey  string
+	// map[header]value
+	VegaAuthMetadata map[string]string
+
+	CommitmentPolicy      string
+	CommitmentAmount      string
+	CommitmentFraction    string
+	CommitmentMarketShare string
+	CommitmentMin         string
+	CommitmentMax         string
+	LPHysteresis          string
+	LPUpdateInterval      time.Duration
+	LPCancelOnExit        bool
+	LPFeePolicy           string
+	LPFeeRank             uint
+	LPFeeUndercut         string
+	LPFeeMin              string
+	LPFeeMax              string
+
+	FundingSkewFactor string
+	FundingMaxSkew    string
+
+	// initial strategy parameters, see StrategyParams
+	LevelSpacing    string
+	Levels          uint
+	BalanceFraction string
+
+	RejectionThreshold uint
+	MaxBlockLag        uint
+	MaxDataLag         time.Duration
 }
 
 func parseFlags() *Config {
@@ -24,6 +86,51 @@ func parseFlags() *Config {
 		vegaGRPCURL = defaultVegaGRPCURL
 	}
 
+	vegaGRPCURLs := []string{}
+	for _, url := range strings.Split(vegaGRPCURL, ",") {
+		if url = strings.TrimSpace(url); len(url) > 0 {
+			vegaGRPCURLs = append(vegaGRPCURLs, url)
+		}
+	}
+	if len(vegaGRPCURLs) <= 0 {
+		log.Fatal("error: -vega-grpc-url requires at least one address")
+	}
+
+	apiHost = getSetting(apiHost, os.Getenv("VEGAMM_API_HOST"))
+	apiToken = getSetting(apiToken, os.Getenv("VEGAMM_API_TOKEN"))
+	if appPort <= 0 || appPort > 65535 {
+		log.Fatalf("error: invalid -port %v", appPort)
+	}
+	if apiReadTimeout <= 0 || apiWriteTimeout <= 0 {
+		log.Fatal("error: -api-read-timeout and -api-write-timeout must be positive")
+	}
+
+	vegaTLSCA = getSetting(vegaTLSCA, os.Getenv("VEGAMM_VEGA_TLS_CA"))
+	vegaTLSCert = getSetting(vegaTLSCert, os.Getenv("VEGAMM_VEGA_TLS_CERT"))
+	vegaTLSKey = getSetting(vegaTLSKey, os.Getenv("VEGAMM_VEGA_TLS_KEY"))
+	vegaGRPCAuth = getSetting(vegaGRPCAuth, os.Getenv("VEGAMM_VEGA_GRPC_AUTH"))
+
+	// a custom CA or a client certificate implies TLS
+	vegaTLS = vegaTLS || len(vegaTLSCA) > 0 || len(vegaTLSCert) > 0
+	if (len(vegaTLSCert) > 0) != (len(vegaTLSKey) > 0) {
+		log.Fatal("error: -vega-tls-cert and -vega-tls-key must be set together")
+	}
+
+	vegaAuthMetadata := map[string]string{}
+	for _, kv := range strings.Split(vegaGRPCAuth, ",") {
+		if kv = strings.TrimSpace(kv); len(kv) <= 0 {
+			continue
+		}
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || len(strings.TrimSpace(key)) <= 0 {
+			log.Fatal("error: invalid -vega-grpc-auth, expected key=value pairs")
+		}
+		vegaAuthMetadata[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+	if len(vegaAuthMetadata) > 0 && !vegaTLS {
+		log.Fatal("error: -vega-grpc-auth requires -vega-tls")
+	}
+
 	if walletURL = getSetting(walletURL, os.Getenv("VEGAMM_WALLET_URL")); len(walletURL) <= 0 {
 		walletURL = defaultWalletURL
 	}
@@ -40,20 +147,156 @@ func parseFlags() *Config {
 		log.Fatal("error: -wallet-pubkey flag is required")
 	}
 
-	if vegaMarket = getSetting(vegaMarket, os.Getenv("VEGAMM_VEGA_MARKET")); len(vegaMarket) <= 0 {
-		log.Fatal("error: -vega-market flag is required")
+	if tickSize = getSetting(tickSize, os.Getenv("VEGAMM_TICK_SIZE")); len(tickSize) <= 0 {
+		tickSize = defaultTickSize
 	}
 
-	if binanceMarket = getSetting(binanceMarket, os.Getenv("VEGAMM_BINANCE_MARKET")); len(binanceMarket) <= 0 {
-		log.Fatal("error: -binance-market flag is required")
+	requirePositive("tick-size", tickSize)
+
+	vegaMarket = getSetting(vegaMarket, os.Getenv("VEGAMM_VEGA_MARKET"))
+	binanceMarket = getSetting(binanceMarket, os.Getenv("VEGAMM_BINANCE_MARKET"))
+	markets = getSetting(markets, os.Getenv("VEGAMM_MARKETS"))
+
+	if strategy = getSetting(strategy, os.Getenv("VEGAMM_STRATEGY")); len(strategy) <= 0 {
+		strategy = defaultStrategy
+	}
+	requireStrategy(strategy)
+
+	marketConfigs := parseMarkets(markets, tickSize, walletPubkey, strategy)
+	if len(marketConfigs) <= 0 {
+		if len(vegaMarket) <= 0 {
+			log.Fatal("error: -vega-market flag is required")
+		}
+		if len(binanceMarket) <= 0 {
+			log.Fatal("error: -binance-market flag is required")
+		}
+		marketConfigs = []MarketConfig{{
+			VegaMarket:    vegaMarket,
+			BinanceMarket: binanceMarket,
+			TickSize:      tickSize,
+			WalletPubkey:  walletPubkey,
+			Strategy:      strategy,
+		}}
 	}
 
 	if lpFee = getSetting(lpFee, os.Getenv("VEGAMM_LP_FEE")); len(lpFee) <= 0 {
 		log.Fatal("error: -lp-fee flag is required")
 	}
 
-	return &Config{
-		VegaGRPCURL:   vegaGRPCURL,
+	if botID = getSetting(botID, os.Getenv("VEGAMM_BOT_ID")); len(botID) <= 0 {
+		botID = defaultBotID
+	}
+
+	if commitmentPolicy = getSetting(commitmentPolicy, os.Getenv("VEGAMM_COMMITMENT_POLICY")); len(commitmentPolicy) <= 0 {
+		commitmentPolicy = defaultCommitmentPolicy
+	}
+
+	commitmentAmount = getSetting(commitmentAmount, os.Getenv("VEGAMM_COMMITMENT_AMOUNT"))
+	commitmentFraction = getSetting(commitmentFraction, os.Getenv("VEGAMM_COMMITMENT_FRACTION"))
+	commitmentMarketShare = getSetting(commitmentMarketShare, os.Getenv("VEGAMM_COMMITMENT_MARKET_SHARE"))
+	commitmentMin = getSetting(commitmentMin, os.Getenv("VEGAMM_COMMITMENT_MIN"))
+	commitmentMax = getSetting(commitmentMax, os.Getenv("VEGAMM_COMMITMENT_MAX"))
+
+	switch commitmentPolicy {
+	case commitmentPolicyFixed:
+		requirePositive("commitment-amount", commitmentAmount)
+	case commitmentPolicyBalance:
+		requirePositive("commitment-fraction", commitmentFraction)
+	case commitmentPolicyMarketShare:
+		requirePositive("commitment-market-share", commitmentMarketShare)
+		if decimal.RequireFromString(commitmentMarketShare).GreaterThanOrEqual(decimal.NewFromInt(1)) {
+			log.Fatal("error: -commitment-market-share must be lower than 1")
+		}
+	default:
+		log.Fatalf("error: unknown -commitment-policy %q", commitmentPolicy)
+	}
+
+	if len(commitmentMin) > 0 {
+		requirePositive("commitment-min", commitmentMin)
+	}
+	if len(commitmentMax) > 0 {
+		requirePositive("commitment-max", commitmentMax)
+	}
+	if len(commitmentMin) > 0 && len(commitmentMax) > 0 &&
+		decimal.RequireFromString(commitmentMin).GreaterThan(decimal.RequireFromString(commitmentMax)) {
+		log.Fatal("error: -commitment-min must be lower than -commitment-max")
+	}
+
+	if lpHysteresis = getSetting(lpHysteresis, os.Getenv("VEGAMM_LP_HYSTERESIS")); len(lpHysteresis) <= 0 {
+		lpHysteresis = defaultLPHysteresis
+	}
+	if d, err := decimal.NewFromString(lpHysteresis); err != nil || d.IsNegative() {
+		log.Fatalf("error: invalid -lp-hysteresis %q", lpHysteresis)
+	}
+
+	if lpFeePolicy = getSetting(lpFeePolicy, os.Getenv("VEGAMM_LP_FEE_POLICY")); len(lpFeePolicy) <= 0 {
+		lpFeePolicy = defaultLPFeePolicy
+	}
+
+	switch lpFeePolicy {
+	case feePolicyFixed, feePolicyUndercut:
+	case feePolicyRank:
+		if lpFeeRank <= 0 {
+			log.Fatal("error: -lp-fee-rank must be at least 1")
+		}
+	default:
+		log.Fatalf("error: unknown -lp-fee-policy %q", lpFeePolicy)
+	}
+
+	lpFeeUndercut = getSetting(lpFeeUndercut, os.Getenv("VEGAMM_LP_FEE_UNDERCUT"))
+	lpFeeMin = getSetting(lpFeeMin, os.Getenv("VEGAMM_LP_FEE_MIN"))
+	lpFeeMax = getSetting(lpFeeMax, os.Getenv("VEGAMM_LP_FEE_MAX"))
+	for name, value := range map[string]string{
+		"lp-fee-undercut": lpFeeUndercut,
+		"lp-fee-min":      lpFeeMin,
+		"lp-fee-max":      lpFeeMax,
+	} {
+		if d, err := decimal.NewFromString(value); len(value) > 0 && (err != nil || d.IsNegative()) {
+			log.Fatalf("error: invalid -%v %q", name, value)
+		}
+	}
+
+	if lpUpdateInterval <= 0 {
+		log.Fatal("error: -lp-update-interval must be positive")
+	}
+
+	if fundingSkewFactor = getSetting(fundingSkewFactor, os.Getenv("VEGAMM_FUNDING_SKEW_FACTOR")); len(fundingSkewFactor) <= 0 {
+		fundingSkewFactor = defaultFundingSkewFactor
+	}
+	if fundingMaxSkew = getSetting(fundingMaxSkew, os.Getenv("VEGAMM_FUNDING_MAX_SKEW")); len(fundingMaxSkew) <= 0 {
+		fundingMaxSkew = defaultFundingMaxSkew
+	}
+	for name, value := range map[string]string{
+		"funding-skew-factor": fundingSkewFactor,
+		"funding-max-skew":    fundingMaxSkew,
+	} {
+		if d, err := decimal.NewFromString(value); err != nil || d.IsNegative() {
+			log.Fatalf("error: invalid -%v %q", name, value)
+		}
+	}
+
+	if levelSpacing = getSetting(levelSpacing, os.Getenv("VEGAMM_LEVEL_SPACING")); len(levelSpacing) <= 0 {
+		levelSpacing = defaultLevelSpacing
+	}
+	if balanceFraction = getSetting(balanceFraction, os.Getenv("VEGAMM_BALANCE_FRACTION")); len(balanceFraction) <= 0 {
+		balanceFraction = defaultBalanceFraction
+	}
+	for name, value := range map[string]string{
+		"level-spacing":    levelSpacing,
+		"balance-fraction": balanceFraction,
+		"lp-fee":           lpFee,
+	} {
+		if _, err := decimal.NewFromString(value); err != nil {
+			log.Fatalf("error: invalid -%v %q", name, value)
+		}
+	}
+
+	if maxDataLag <= 0 {
+		log.Fatal("error: -max-data-lag must be positive")
+	}
+
+	config := &Config{
+		VegaGRPCURLs:  vegaGRPCURLs,
 		WalletURL:     walletURL,
 		BinanceWSURL:  binanceWSURL,
 		WalletToken:   walletToken,
@@ -61,7 +304,105 @@ func parseFlags() *Config {
 		VegaMarket:    vegaMarket,
 		BinanceMarket: binanceMarket,
 		LPFee:         lpFee,
+		TickSize:      tickSize,
+		BotID:         botID,
+		Strategy:      strategy,
+
+		APIHost:         apiHost,
+		APIPort:         appPort,
+		APIReadTimeout:  apiReadTimeout,
+		APIWriteTimeout: apiWriteTimeout,
+		APIToken:        apiToken,
+
+		Markets: marketConfigs,
+
+		VegaTLS:          vegaTLS,
+		VegaTLSCA:        vegaTLSCA,
+		VegaTLSCert:      vegaTLSCert,
+		VegaTLSKey:       vegaTLSKey,
+		VegaAuthMetadata: vegaAuthMetadata,
+
+		CommitmentPolicy:      commitmentPolicy,
+		CommitmentAmount:      commitmentAmount,
+		CommitmentFraction:    commitmentFraction,
+		CommitmentMarketShare: commitmentMarketShare,
+		CommitmentMin:         commitmentMin,
+		CommitmentMax:         commitmentMax,
+		LPHysteresis:          lpHysteresis,
+		LPUpdateInterval:      lpUpdateInterval,
+		LPCancelOnExit:        lpCancelOnExit,
+		LPFeePolicy:           lpFeePolicy,
+		LPFeeRank:             lpFeeRank,
+		LPFeeUndercut:         lpFeeUndercut,
+		LPFeeMin:              lpFeeMin,
+		LPFeeMax:              lpFeeMax,
+
+		FundingSkewFactor: fundingSkewFactor,
+		FundingMaxSkew:    fundingMaxSkew,
+
+		LevelSpacing:    levelSpacing,
+		Levels:          levels,
+		BalanceFraction: balanceFraction,
+
+		RejectionThreshold: rejectionThreshold,
+		MaxBlockLag:        maxBlockLag,
+		MaxDataLag:         maxDataLag,
 	}
+
+	if err := NewStrategyParams(config).Validate(NewFeePolicy(config)); err != nil {
+		log.Fatalf("error: invalid strategy parameters: %v", err)
+	}
+
+	return config
+}
+
+// parseMarkets parses a comma separated list of
+// vegaMarket:binanceMarket[:tickSize[:pubkey[:strategy]]] market pairs,
+// the optional fields left empty take the default values.
+func parseMarkets(value, tickSize, pubkey, strategy string) []MarketConfig {
+	out := []MarketConfig{}
+	// map[pubkey+market]struct{}
+	seen := map[string]struct{}{}
+	for _, m := range strings.Split(value, ",") {
+		if m = strings.TrimSpace(m); len(m) <= 0 {
+			continue
+		}
+
+		parts := strings.Split(m, ":")
+		if len(parts) < 2 || len(parts) > 5 || len(parts[0]) <= 0 || len(parts[1]) <= 0 {
+			log.Fatalf("error: invalid -markets entry %q, expected vegaMarket:binanceMarket[:tickSize[:pubkey[:strategy]]]", m)
+		}
+		parts = append(parts, make([]string, 5-len(parts))...)
+
+		mc := MarketConfig{
+			VegaMarket:    parts[0],
+			BinanceMarket: parts[1],
+			TickSize:      getSetting(parts[2], tickSize),
+			WalletPubkey:  getSetting(parts[3], pubkey),
+			Strategy:      getSetting(parts[4], strategy),
+		}
+		requirePositive("markets tick size", mc.TickSize)
+		requireStrategy(mc.Strategy)
+
+		if _, ok := seen[mc.WalletPubkey+mc.VegaMarket]; ok {
+			log.Fatalf("error: market %v configured more than once for key %v", mc.VegaMarket, mc.WalletPubkey)
+		}
+		seen[mc.WalletPubkey+mc.VegaMarket] = struct{}{}
+		out = append(out, mc)
+	}
+
+	return out
+}
+
+// ForMarket returns the configuration used to run one of the markets.
+func (c *Config) ForMarket(m MarketConfig) *Config {
+	config := *c
+	config.VegaMarket = m.VegaMarket
+	config.BinanceMarket = m.BinanceMarket
+	config.TickSize = m.TickSize
+	config.WalletPubkey = m.WalletPubkey
+	config.Strategy = m.Strategy
+	return &config
 }
 
 func getSetting(flag, env string) string {
@@ -71,3 +412,19 @@ func getSetting(flag, env string) string {
 
 	return flag
 }
+
+// requireStrategy exits if the strategy is unknown.
+func requireStrategy(strategy string) {
+	switch strategy {
+	case strategyLiquidity, strategyQuote:
+	default:
+		log.Fatalf("error: unknown strategy %q", strategy)
+	}
+}
+
+// requirePositive exits if the setting is not a positive number.
+func requirePositive(name, value string) {
+	if d, err := decimal.NewFromString(value); err != nil || !d.IsPositive() {
+		log.Fatalf("error: invalid -%v %q, must be a positive number", name, value)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	commandspb "code.vegaprotocol.io/vega/protos/vega/commands/v1"
+)
+
+const (
+	controlPause     = "pause"
+	controlResume    = "resume"
+	controlCancelAll = "cancel-all"
+	controlFlatten   = "flatten"
+)
+
+// ControlStatus reflects the operator commands applied to the strategy.
+type ControlStatus struct {
+	Paused bool
+	// commands waiting for the next strategy execution
+	PendingCancelAll bool
+	PendingFlatten   bool
+	LastCommand      string
+	LastCommandAt    time.Time
+}
+
+// Control records an operator command, it's applied
+// by the strategy as soon as it wakes up.
+func (s *StrategyStore) Control(command string) {
+	s.mu.Lock()
+	switch command {
+	case controlPause:
+		s.control.Paused = true
+	case controlResume:
+		s.control.Paused = false
+	case controlCancelAll:
+		s.control.PendingCancelAll = true
+	case controlFlatten:
+		s.control.PendingFlatten = true
+	}
+	s.control.LastCommand = command
+	s.control.LastCommandAt = time.Now()
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// takeCommands returns the one-off commands to apply, and clears them.
+func (s *StrategyStore) takeCommands() (paused, cancelAll, flatten bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cancelAll, flatten = s.control.PendingCancelAll, s.control.PendingFlatten
+	s.control.PendingCancelAll, s.control.PendingFlatten = false, false
+	return s.control.Paused, cancelAll, flatten
+}
+
+func (s *StrategyStore) GetControlStatus() ControlStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.control
+}
+
+// Wake is notified when a command needs to be applied.
+func (s *StrategyStore) Wake() <-chan struct{} {
+	return s.wake
+}
+
+// getFlattenOrder returns a market order closing our position,
+// nil if there's no position or the market is a spot market.
+func getFlattenOrder(mkt *vegapb.Market, pos *vegapb.Position, batchRef string) *commandspb.OrderSubmission {
+	if len(getBaseAsset(mkt)) > 0 || pos == nil || pos.OpenVolume == 0 {
+		return nil
+	}
+
+	side, size := vegapb.Side_SIDE_SELL, pos.OpenVolume
+	if size < 0 {
+		side, size = vegapb.Side_SIDE_BUY, -size
+	}
+
+	return &commandspb.OrderSubmission{
+		MarketId:    mkt.Id,
+		Size:        uint64(size),
+		Side:        side,
+		Type:        vegapb.Order_TYPE_MARKET,
+		TimeInForce: vegapb.Order_TIME_IN_FORCE_IOC,
+		ReduceOnly:  true,
+		// level 0 is never used by the quotes
+		Reference: newOrderReference(batchRef, side, 0),
+	}
+}
+
+// controlHandler applies a command to the bots selected by the optional
+// pubkey and market query parameters, all of them by default.
+func controlHandler(
+	config *Config,
+	bots map[string]map[string]*MarketBot,
+	command string,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !authorized(config, w, r) {
+			return
+		}
+
+		selected := selectBots(bots, r)
+		if len(selected) <= 0 {
+			http.Error(w, "no matching market", http.StatusNotFound)
+			return
+		}
+
+		// map[pubkey][]market
+		applied := map[string][]string{}
+		for pubkey, markets := range selected {
+			for id, bot := range markets {
+				bot.strategy.Control(command)
+				applied[pubkey] = append(applied[pubkey], id)
+			}
+		}
+
+		log.Printf("operator command %v applied to %v", command, applied)
+		out, _ := json.Marshal(&applied)
+		fmt.Fprintf(w, "%v", string(out))
+	}
+}
+
+// authorized checks the request carries the API token as a bearer token,
+// and replies with an error if not. Without a token nothing is authorized.
+func authorized(config *Config, w http.ResponseWriter, r *http.Request) bool {
+	if len(config.APIToken) <= 0 {
+		http.Error(w, "disabled, no API token configured", http.StatusForbidden)
+		return false
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(config.APIToken)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	return true
+}
+
+// selectBots returns the bots matching the optional pubkey
+// and market query parameters of the request.
+func selectBots(
+	bots map[string]map[string]*MarketBot,
+	r *http.Request,
+) map[string]map[string]*MarketBot {
+	pubkey, market := r.URL.Query().Get("pubkey"), r.URL.Query().Get("market")
+
+	selected := map[string]map[string]*MarketBot{}
+	for k, markets := range bots {
+		if len(pubkey) > 0 && k != pubkey {
+			continue
+		}
+		for id, bot := range markets {
+			if len(market) > 0 && id != market {
+				continue
+			}
+			if _, ok := selected[k]; !ok {
+				selected[k] = map[string]*MarketBot{}
+			}
+			selected[k][id] = bot
+		}
+	}
+
+	return selected
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// dataNodeDialOptions returns the transport and per-RPC credentials
+// used to connect to the data nodes.
+func dataNodeDialOptions(config *Config) ([]grpc.DialOption, error) {
+	if !config.VegaTLS {
+		return []grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		}, nil
+	}
+
+	// system roots unless a custom CA is given
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if len(config.VegaTLSCA) > 0 {
+		pem, err := os.ReadFile(config.VegaTLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA certificate: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no valid certificate in CA file")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if len(config.VegaTLSCert) > 0 {
+		cert, err := tls.LoadX509KeyPair(config.VegaTLSCert, config.VegaTLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+	}
+	if len(config.VegaAuthMetadata) > 0 {
+		opts = append(opts, grpc.WithPerRPCCredentials(authMetadata(config.VegaAuthMetadata)))
+	}
+
+	return opts, nil
+}
+
+// authMetadata is added to all the requests sent to the data node,
+// e.g. an API key or a bearer token required by hosted nodes.
+type authMetadata map[string]string
+
+func (a authMetadata) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return a, nil
+}
+
+// RequireTransportSecurity makes sure the credentials
+// are never sent over an insecure connection.
+func (a authMetadata) RequireTransportSecurity() bool {
+	return true
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	apipb "code.vegaprotocol.io/vega/protos/data-node/api/v2"
+	"golang.org/x/exp/slices"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	dataNodeProbeInterval = 10 * time.Second
+	dataNodeProbeTimeout  = 5 * time.Second
+)
+
+// DataNodeStatus is the health of a data node as of the last probe.
+type DataNodeStatus struct {
+	URL         string
+	Current     bool
+	BlockHeight uint64
+	Latency     time.Duration
+	Error       string
+	ProbedAt    time.Time
+}
+
+type dataNode struct {
+	url  string
+	conn *grpc.ClientConn
+	svc  apipb.TradingDataServiceClient
+
+	height   uint64
+	latency  time.Duration
+	err      error
+	probedAt time.Time
+}
+
+// DataNodePool connects to a list of data nodes, and always selects
+// the healthiest one to be used by the bot. When the current node falls
+// behind or fails, the pool fails over to another one and cancels the
+// context of the current streams so they reconnect to the new node.
+type DataNodePool struct {
+	// how many blocks a node can be behind the
+	// most advanced one before we stop using it
+	maxBlockLag uint64
+
+	mu      sync.RWMutex
+	nodes   []*dataNode
+	current *dataNode
+	// cancelled when we move to another node
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// last block height and vega time seen on the current node,
+	// the only source of both for all the bots of the process
+	blockHeight uint64
+	vegaTime    time.Time
+}
+
+func NewDataNodePool(config *Config) *DataNodePool {
+	p := &DataNodePool{
+		maxBlockLag: uint64(config.MaxBlockLag),
+	}
+
+	opts, err := dataNodeDialOptions(config)
+	if err != nil {
+		log.Fatalf("could not configure the vega nodes connection: %v", err)
+	}
+
+	for _, url := range config.VegaGRPCURLs {
+		conn, err := grpc.Dial(url, opts...)
+		if err != nil {
+			log.Fatalf("could not open connection with vega node %v: %v", url, err)
+		}
+
+		p.nodes = append(p.nodes, &dataNode{
+			url:  url,
+			conn: conn,
+			svc:  apipb.NewTradingDataServiceClient(conn),
+		})
+	}
+
+	p.probe()
+	if !p.selectNode() {
+		log.Fatalf("none of the vega nodes are available: %v", p.Status())
+	}
+
+	return p
+}
+
+// Client returns the client of the current data node, and a context
+// which is cancelled as soon as we fail over to another node.
+func (p *DataNodePool) Client() (apipb.TradingDataServiceClient, context.Context) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.current.svc, p.ctx
+}
+
+// Run probes the data nodes periodically and fails over if needed.
+func (p *DataNodePool) Run() {
+	go p.pollVegaTime()
+
+	for range time.NewTicker(dataNodeProbeInterval).C {
+		p.probe()
+		p.selectNode()
+	}
+}
+
+// pollVegaTime polls the current data node for the block height,
+// which is returned in the headers of every response, and for the
+// vega time used to detect a lagging data node.
+func (p *DataNodePool) pollVegaTime() {
+	for range time.NewTicker(time.Second).C {
+		svc, _ := p.Client()
+
+		var header metadata.MD
+		resp, err := svc.GetVegaTime(context.Background(), &apipb.GetVegaTimeRequest{}, grpc.Header(&header))
+		if err != nil {
+			log.Printf("could not get vega time: %v", err)
+			continue
+		}
+
+		height, err := getBlockHeight(header)
+		if err != nil {
+			log.Printf("invalid block height header: %v", err)
+		}
+
+		p.mu.Lock()
+		p.vegaTime = time.Unix(0, resp.Timestamp)
+		// a node we failed over to may be a block or two behind
+		if height > p.blockHeight {
+			p.blockHeight = height
+		}
+		p.mu.Unlock()
+	}
+}
+
+// BlockHeight returns the last block height seen, 0 if none yet.
+func (p *DataNodePool) BlockHeight() uint64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.blockHeight
+}
+
+// VegaTime returns the time of the last block seen, zero if none yet.
+func (p *DataNodePool) VegaTime() time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.vegaTime
+}
+
+func (p *DataNodePool) Status() []DataNodeStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	out := make([]DataNodeStatus, 0, len(p.nodes))
+	for _, n := range p.nodes {
+		s := DataNodeStatus{
+			URL:         n.url,
+			Current:     n == p.current,
+			BlockHeight: n.height,
+			Latency:     n.latency,
+			ProbedAt:    n.probedAt,
+		}
+		if n.err != nil {
+			s.Error = n.err.Error()
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func (p *DataNodePool) probe() {
+	var wg sync.WaitGroup
+	for _, n := range p.nodes {
+		wg.Add(1)
+		go func(n *dataNode) {
+			defer wg.Done()
+
+			height, latency, err := probeDataNode(n.svc)
+
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			n.height, n.latency, n.err, n.probedAt = height, latency, err, time.Now()
+		}(n)
+	}
+	wg.Wait()
+}
+
+// selectNode moves to the healthiest node if the current one is failing or
+// lagging behind, it returns false if there's no healthy node at all.
+func (p *DataNodePool) selectNode() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var best uint64
+	for _, n := range p.nodes {
+		if n.err == nil && n.height > best {
+			best = n.height
+		}
+	}
+
+	healthy := func(n *dataNode) bool {
+		return n.err == nil && n.height+p.maxBlockLag >= best
+	}
+
+	if p.current != nil && healthy(p.current) {
+		return true
+	}
+
+	candidates := []*dataNode{}
+	for _, n := range p.nodes {
+		if healthy(n) {
+			candidates = append(candidates, n)
+		}
+	}
+	if len(candidates) <= 0 {
+		log.Printf("none of the vega nodes are healthy, keeping the current one")
+		return p.current != nil
+	}
+
+	slices.SortFunc(candidates, func(a, b *dataNode) bool {
+		return a.latency < b.latency
+	})
+
+	if p.current != nil {
+		log.Printf("vega node %v unhealthy (height: %v, best: %v, err: %v), failing over to %v",
+			p.current.url, p.current.height, best, p.current.err, candidates[0].url)
+		p.cancel()
+	} else {
+		log.Printf("using vega node %v", candidates[0].url)
+	}
+
+	p.current = candidates[0]
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	return true
+}
+
+// probeDataNode returns the block height of the data node
+// and how long it took to answer.
+func probeDataNode(svc apipb.TradingDataServiceClient) (uint64, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dataNodeProbeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	var header metadata.MD
+	_, err := svc.GetVegaTime(ctx, &apipb.GetVegaTimeRequest{}, grpc.Header(&header))
+	if err != nil {
+		return 0, 0, err
+	}
+	latency := time.Since(start)
+
+	height, err := getBlockHeight(header)
+	return height, latency, err
+}
+
+func getBlockHeight(header metadata.MD) (uint64, error) {
+	values := header.Get(blockHeightHeader)
+	if len(values) <= 0 {
+		return 0, errors.New("no block height header")
+	}
+
+	return strconv.ParseUint(values[0], 10, 64)
+}
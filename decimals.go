@@ -0,0 +1,66 @@
+package main
+
+import (
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	"github.com/shopspring/decimal"
+)
+
+type decimals struct {
+	positionFactor decimal.Decimal
+	priceFactor    decimal.Decimal
+	// smallest price increment of the market,
+	// in market precision
+	tickSize decimal.Decimal
+}
+
+func newDecimals(mkt *vegapb.Market, asset *vegapb.Asset, tickSize decimal.Decimal) decimals {
+	return decimals{
+		positionFactor: decimal.NewFromFloat(10).Pow(decimal.NewFromInt(mkt.PositionDecimalPlaces)),
+		priceFactor:    decimal.NewFromFloat(10).Pow(decimal.NewFromInt(int64(mkt.DecimalPlaces))),
+		tickSize:       tickSize,
+	}
+}
+
+func (d decimals) FromMarketPricePrecision(price decimal.Decimal) decimal.Decimal {
+	return price.Div(d.priceFactor)
+}
+
+func (d decimals) FromMarketPositionPrecision(pos decimal.Decimal) decimal.Decimal {
+	return pos.Div(d.positionFactor)
+}
+
+func (d decimals) ToMarketPricePrecision(price decimal.Decimal) decimal.Decimal {
+	return price.Mul(d.priceFactor)
+}
+
+func (d decimals) ToMarketPositionPrecision(pos decimal.Decimal) decimal.Decimal {
+	return pos.Mul(d.positionFactor)
+}
+
+// ToMarketTickPrice converts the price to market precision and aligns
+// it on the tick size. Bids are rounded down and asks rounded up so
+// the rounding never makes a quote more aggressive.
+func (d decimals) ToMarketTickPrice(price decimal.Decimal, side vegapb.Side) decimal.Decimal {
+	return d.AlignToTick(d.ToMarketPricePrecision(price), side == vegapb.Side_SIDE_SELL)
+}
+
+// AlignToTick aligns a price already in market precision on the tick size.
+func (d decimals) AlignToTick(price decimal.Decimal, up bool) decimal.Decimal {
+	tick := d.tickSize
+	if !tick.IsPositive() {
+		tick = decimal.NewFromInt(1)
+	}
+
+	ticks := price.Div(tick)
+	if up {
+		return ticks.Ceil().Mul(tick)
+	}
+	return ticks.Floor().Mul(tick)
+}
+
+// ToMarketPositionIncrement converts the size to market precision
+// rounded down to the smallest position increment, the result
+// can be zero or negative in which case no order should be placed.
+func (d decimals) ToMarketPositionIncrement(size decimal.Decimal) decimal.Decimal {
+	return d.ToMarketPositionPrecision(size).Floor()
+}
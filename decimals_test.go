@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	"github.com/shopspring/decimal"
+)
+
+func testDecimals(priceDP uint64, positionDP int64, tickSize string) decimals {
+	return newDecimals(
+		&vegapb.Market{DecimalPlaces: priceDP, PositionDecimalPlaces: positionDP},
+		nil,
+		decimal.RequireFromString(tickSize),
+	)
+}
+
+func TestDecimalsToMarketTickPrice(t *testing.T) {
+	cases := []struct {
+		name     string
+		d        decimals
+		price    string
+		side     vegapb.Side
+		expected string
+	}{
+		{"bid truncated to precision", testDecimals(2, 0, "1"), "12.345", vegapb.Side_SIDE_BUY, "1234"},
+		{"ask rounded up to precision", testDecimals(2, 0, "1"), "12.341", vegapb.Side_SIDE_SELL, "1235"},
+		{"aligned bid is unchanged", testDecimals(2, 0, "5"), "12.35", vegapb.Side_SIDE_BUY, "1235"},
+		{"aligned ask is unchanged", testDecimals(2, 0, "5"), "12.35", vegapb.Side_SIDE_SELL, "1235"},
+		{"bid rounded down to tick", testDecimals(2, 0, "5"), "12.39", vegapb.Side_SIDE_BUY, "1235"},
+		{"ask rounded up to tick", testDecimals(2, 0, "5"), "12.31", vegapb.Side_SIDE_SELL, "1235"},
+		{"large tick", testDecimals(0, 0, "100"), "1999", vegapb.Side_SIDE_BUY, "1900"},
+		{"zero tick falls back to 1", testDecimals(1, 0, "0"), "1.25", vegapb.Side_SIDE_SELL, "13"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := c.d.ToMarketTickPrice(decimal.RequireFromString(c.price), c.side)
+			if !got.Equal(decimal.RequireFromString(c.expected)) {
+				t.Errorf("expected %v, got %v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestDecimalsToMarketPositionIncrement(t *testing.T) {
+	cases := []struct {
+		name     string
+		d        decimals
+		size     string
+		expected string
+	}{
+		{"exact increment", testDecimals(0, 2, "1"), "1.25", "125"},
+		{"rounded down", testDecimals(0, 2, "1"), "1.259", "125"},
+		{"rounds to zero", testDecimals(0, 0, "1"), "0.9", "0"},
+		{"negative size", testDecimals(0, 1, "1"), "-0.25", "-3"},
+		{"negative position decimals", testDecimals(0, -1, "1"), "25", "2"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := c.d.ToMarketPositionIncrement(decimal.RequireFromString(c.size))
+			if !got.Equal(decimal.RequireFromString(c.expected)) {
+				t.Errorf("expected %v, got %v", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestDecimalsRoundTrip(t *testing.T) {
+	cases := []struct {
+		name  string
+		d     decimals
+		value string
+	}{
+		{"no decimals", testDecimals(0, 0, "1"), "42"},
+		{"price and position decimals", testDecimals(5, 3, "1"), "1234.56789"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v := decimal.RequireFromString(c.value)
+			if got := c.d.FromMarketPricePrecision(c.d.ToMarketPricePrecision(v)); !got.Equal(v) {
+				t.Errorf("price: expected %v, got %v", v, got)
+			}
+			if got := c.d.FromMarketPositionPrecision(c.d.ToMarketPositionPrecision(v)); !got.Equal(v) {
+				t.Errorf("position: expected %v, got %v", v, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"log"
+
+	"github.com/shopspring/decimal"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	// always nominate the configured fee
+	feePolicyFixed = "fixed"
+	// nominate the fee of the n-th cheapest other provider
+	feePolicyRank = "rank"
+	// nominate the current liquidity fee of the market minus the undercut
+	feePolicyUndercut = "undercut"
+
+	// number of decimals kept on the nominated fee
+	feeDecimals = 6
+)
+
+// FeePolicy decides the liquidity fee we nominate
+// based on the fees of the other providers.
+type FeePolicy struct {
+	Policy string
+	// fee used by the fixed policy, and as a fallback
+	// if there's not enough information for the other ones
+	Fee decimal.Decimal
+	// 1 is the cheapest provider
+	Rank uint
+	// how much we undercut the reference fee
+	Undercut decimal.Decimal
+	// bounds applied on the fee, zero means no bound
+	Min decimal.Decimal
+	Max decimal.Decimal
+}
+
+func NewFeePolicy(config *Config) FeePolicy {
+	parse := func(v string) decimal.Decimal {
+		if len(v) <= 0 {
+			return decimal.Zero
+		}
+		return decimal.RequireFromString(v)
+	}
+
+	return FeePolicy{
+		Policy:   config.LPFeePolicy,
+		Fee:      decimal.RequireFromString(config.LPFee),
+		Rank:     config.LPFeeRank,
+		Undercut: parse(config.LPFeeUndercut),
+		Min:      parse(config.LPFeeMin),
+		Max:      parse(config.LPFeeMax),
+	}
+}
+
+// NominatedFee returns the liquidity fee we should nominate.
+func (p FeePolicy) NominatedFee(vega *VegaStore, pubkey string) decimal.Decimal {
+	fee := p.Fee
+
+	switch p.Policy {
+	case feePolicyRank:
+		fees := otherProvidersFees(vega, pubkey)
+		if len(fees) <= 0 {
+			log.Printf("no other liquidity providers, using fee %v", p.Fee)
+			break
+		}
+
+		rank := int(p.Rank)
+		if rank > len(fees) {
+			rank = len(fees)
+		}
+		fee = fees[rank-1].Sub(p.Undercut)
+	case feePolicyUndercut:
+		current, err := decimal.NewFromString(
+			vega.GetMarket().GetFees().GetFactors().GetLiquidityFee(),
+		)
+		if err != nil {
+			log.Printf("no market liquidity fee available, using fee %v", p.Fee)
+			break
+		}
+
+		// once we are the marginal provider the market fee is ours,
+		// undercutting it would lower our fee on every update
+		if lp := vega.GetLiquidityProvison(); lp != nil {
+			if ours, err := decimal.NewFromString(lp.Fee); err == nil && ours.Equal(current) {
+				fee = ours
+				break
+			}
+		}
+
+		fee = current.Sub(p.Undercut)
+	}
+
+	if p.Min.IsPositive() && fee.LessThan(p.Min) {
+		fee = p.Min
+	}
+	if p.Max.IsPositive() && fee.GreaterThan(p.Max) {
+		fee = p.Max
+	}
+	if fee.IsNegative() {
+		fee = decimal.Zero
+	}
+
+	return fee.Truncate(feeDecimals)
+}
+
+// otherProvidersFees returns the fees nominated by the other
+// liquidity providers of the market, cheapest first.
+func otherProvidersFees(vega *VegaStore, pubkey string) []decimal.Decimal {
+	fees := []decimal.Decimal{}
+	for _, lp := range vega.GetMarketLiquidityProvisions() {
+		if lp.PartyId == pubkey {
+			continue
+		}
+
+		fee, err := decimal.NewFromString(lp.Fee)
+		if err != nil {
+			continue
+		}
+		fees = append(fees, fee)
+	}
+
+	slices.SortFunc(fees, func(a, b decimal.Decimal) bool {
+		return a.LessThan(b)
+	})
+
+	return fees
+}
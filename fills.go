@@ -0,0 +1,101 @@
+package main
+
+import (
+	"time"
+
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+)
+
+// how many of our most recent fills we keep
+const maxFills = 1000
+
+// Fill is one of our trades, prices and sizes are in
+// market precision and fees in asset precision.
+type Fill struct {
+	TradeID   string
+	OrderID   string
+	Side      vegapb.Side
+	Price     string
+	Size      uint64
+	Aggressor bool
+	Timestamp time.Time
+	// fees we paid on the trade
+	MakerFee          string
+	InfrastructureFee string
+	LiquidityFee      string
+	// maker fee paid to us by the aggressor
+	MakerFeeReceived string
+}
+
+// newFill returns our side of the trade, false if we're not part of it.
+func newFill(pubkey string, t *vegapb.Trade) (Fill, bool) {
+	f := Fill{
+		TradeID:   t.Id,
+		Price:     t.Price,
+		Size:      t.Size,
+		Timestamp: time.Unix(0, t.Timestamp),
+	}
+
+	var paid, other *vegapb.Fee
+	switch pubkey {
+	case t.Buyer:
+		f.Side, f.OrderID = vegapb.Side_SIDE_BUY, t.BuyOrder
+		paid, other = t.BuyerFee, t.SellerFee
+	case t.Seller:
+		f.Side, f.OrderID = vegapb.Side_SIDE_SELL, t.SellOrder
+		paid, other = t.SellerFee, t.BuyerFee
+	default:
+		return Fill{}, false
+	}
+
+	f.Aggressor = t.Aggressor == f.Side
+	f.MakerFee = paid.GetMakerFee()
+	f.InfrastructureFee = paid.GetInfrastructureFee()
+	f.LiquidityFee = paid.GetLiquidityFee()
+	if !f.Aggressor {
+		f.MakerFeeReceived = other.GetMakerFee()
+	}
+
+	return f, true
+}
+
+// fillHistory is a ring buffer of our most recent fills,
+// it's not safe for concurrent use.
+type fillHistory struct {
+	fills []Fill
+	// index of the oldest fill once the buffer is full
+	next int
+	// map[tradeID]struct{}
+	seen map[string]struct{}
+}
+
+func newFillHistory() *fillHistory {
+	return &fillHistory{
+		fills: make([]Fill, 0, maxFills),
+		seen:  map[string]struct{}{},
+	}
+}
+
+// add records the fill, unless we already know about it.
+func (h *fillHistory) add(f Fill) {
+	if _, ok := h.seen[f.TradeID]; ok {
+		return
+	}
+	h.seen[f.TradeID] = struct{}{}
+
+	if len(h.fills) < maxFills {
+		h.fills = append(h.fills, f)
+		return
+	}
+
+	delete(h.seen, h.fills[h.next].TradeID)
+	h.fills[h.next] = f
+	h.next = (h.next + 1) % maxFills
+}
+
+// list returns the fills, oldest first.
+func (h *fillHistory) list() []Fill {
+	out := make([]Fill, 0, len(h.fills))
+	out = append(out, h.fills[h.next:]...)
+	return append(out, h.fills[:h.next]...)
+}
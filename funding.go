@@ -0,0 +1,97 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	"github.com/shopspring/decimal"
+)
+
+// how many funding periods we keep
+const maxFundingPeriods = 10
+
+// FundingPeriod is a completed funding period of a perpetual market.
+type FundingPeriod struct {
+	Seq   uint64
+	Start time.Time
+	End   time.Time
+	// positive when the longs pay the shorts
+	Rate decimal.Decimal
+}
+
+// FundingStatus is the funding of the perpetual market
+// as of the last strategy execution.
+type FundingStatus struct {
+	// estimated rate of the current period, positive
+	// when the longs pay the shorts
+	EstimatedRate decimal.Decimal
+	// rate of the last completed period
+	LastRate decimal.Decimal
+	// relative shift applied on the reference prices
+	Skew decimal.Decimal
+	// funding our current position would receive over
+	// a period at the estimated rate, negative if we pay,
+	// in settlement asset units
+	ExpectedCarry decimal.Decimal
+}
+
+// getFundingStatus returns the funding of the market, and false
+// if the market is not a perpetual.
+func getFundingStatus(
+	d decimals,
+	mkt *vegapb.Market,
+	md *vegapb.MarketData,
+	pos *vegapb.Position,
+	periods []FundingPeriod,
+	skewFactor, maxSkew decimal.Decimal,
+) (FundingStatus, bool) {
+	if mkt.GetTradableInstrument().GetInstrument().GetPerpetual() == nil {
+		return FundingStatus{}, false
+	}
+
+	status := FundingStatus{}
+	if len(periods) > 0 {
+		status.LastRate = periods[len(periods)-1].Rate
+	}
+
+	// no estimate yet at the start of a period,
+	// the last rate is the best we have
+	status.EstimatedRate = status.LastRate
+	if rate, err := decimal.NewFromString(
+		md.GetProductData().GetPerpetualData().GetFundingRate(),
+	); err == nil {
+		status.EstimatedRate = rate
+	}
+
+	// when the longs pay we move our prices down to sell more and
+	// buy less, so we lean short and receive funding, and the
+	// other way around
+	status.Skew = status.EstimatedRate.Mul(skewFactor).Neg()
+	if status.Skew.GreaterThan(maxSkew) {
+		status.Skew = maxSkew
+	} else if status.Skew.LessThan(maxSkew.Neg()) {
+		status.Skew = maxSkew.Neg()
+	}
+
+	if pos != nil {
+		markPrice, _ := decimal.NewFromString(md.GetMarkPrice())
+		notional := d.FromMarketPositionPrecision(decimal.NewFromInt(pos.OpenVolume)).
+			Mul(d.FromMarketPricePrecision(markPrice))
+		status.ExpectedCarry = notional.Mul(status.EstimatedRate).Neg()
+	}
+
+	return status, true
+}
+
+// applyFundingSkew shifts the reference prices by the funding skew.
+func applyFundingSkew(status FundingStatus, bid, ask decimal.Decimal) (decimal.Decimal, decimal.Decimal) {
+	if status.Skew.IsZero() {
+		return bid, ask
+	}
+
+	shift := decimal.NewFromInt(1).Add(status.Skew)
+	log.Printf("funding rate %v, skewing reference prices by %v, expected carry %v",
+		status.EstimatedRate, status.Skew, status.ExpectedCarry)
+	return bid.Mul(shift), ask.Mul(shift)
+}
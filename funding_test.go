@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+
+	"code.vegaprotocol.io/vega/libs/ptr"
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	"github.com/shopspring/decimal"
+)
+
+func testFundingMarket(perpetual bool) *vegapb.Market {
+	instrument := &vegapb.Instrument{}
+	if perpetual {
+		instrument.Product = &vegapb.Instrument_Perpetual{Perpetual: &vegapb.Perpetual{}}
+	} else {
+		instrument.Product = &vegapb.Instrument_Future{Future: &vegapb.Future{}}
+	}
+	return &vegapb.Market{TradableInstrument: &vegapb.TradableInstrument{Instrument: instrument}}
+}
+
+func testFundingMarketData(rate string) *vegapb.MarketData {
+	return &vegapb.MarketData{
+		MarkPrice: "100",
+		ProductData: &vegapb.ProductData{
+			Data: &vegapb.ProductData_PerpetualData{
+				PerpetualData: &vegapb.PerpetualData{FundingRate: rate},
+			},
+		},
+	}
+}
+
+func TestGetFundingStatus(t *testing.T) {
+	cases := []struct {
+		name      string
+		perpetual bool
+		rate      string
+		periods   []FundingPeriod
+		// nil if no position
+		openVolume *int64
+		ok         bool
+		skew       string
+		carry      string
+	}{
+		{"not a perpetual", false, "0.0005", nil, nil, false, "0", "0"},
+		{"longs pay, skewed down", true, "0.0005", nil, nil, true, "-0.005", "0"},
+		{"shorts pay, skewed up", true, "-0.0005", nil, nil, true, "0.005", "0"},
+		{"skew capped down", true, "0.01", nil, nil, true, "-0.01", "0"},
+		{"skew capped up", true, "-0.01", nil, nil, true, "0.01", "0"},
+		{
+			"no estimate uses the last rate", true, "",
+			[]FundingPeriod{{Rate: decimal.RequireFromString("0.0001")}, {Rate: decimal.RequireFromString("0.0002")}},
+			nil, true, "-0.002", "0",
+		},
+		{"long pays when longs pay", true, "0.0005", nil, ptr.From[int64](2), true, "-0.005", "-0.1"},
+		{"short receives when longs pay", true, "0.0005", nil, ptr.From[int64](-2), true, "-0.005", "0.1"},
+		{"long receives when shorts pay", true, "-0.0005", nil, ptr.From[int64](2), true, "0.005", "0.1"},
+		{"short pays when shorts pay", true, "-0.0005", nil, ptr.From[int64](-2), true, "0.005", "-0.1"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var pos *vegapb.Position
+			if c.openVolume != nil {
+				pos = &vegapb.Position{OpenVolume: *c.openVolume}
+			}
+
+			status, ok := getFundingStatus(
+				testDecimals(0, 0, "1"), testFundingMarket(c.perpetual), testFundingMarketData(c.rate),
+				pos, c.periods, decimal.NewFromInt(10), decimal.RequireFromString("0.01"),
+			)
+			if ok != c.ok {
+				t.Fatalf("expected ok %v, got %v", c.ok, ok)
+			}
+			if !status.Skew.Equal(decimal.RequireFromString(c.skew)) {
+				t.Errorf("expected skew %v, got %v", c.skew, status.Skew)
+			}
+			if !status.ExpectedCarry.Equal(decimal.RequireFromString(c.carry)) {
+				t.Errorf("expected carry %v, got %v", c.carry, status.ExpectedCarry)
+			}
+		})
+	}
+}
+
+func TestApplyFundingSkew(t *testing.T) {
+	cases := []struct {
+		name     string
+		skew     string
+		bid, ask string
+		newBid   string
+		newAsk   string
+	}{
+		{"no skew", "0", "100", "102", "100", "102"},
+		{"skewed down", "-0.005", "100", "102", "99.5", "101.49"},
+		{"skewed up", "0.005", "100", "102", "100.5", "102.51"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			bid, ask := applyFundingSkew(
+				FundingStatus{Skew: decimal.RequireFromString(c.skew)},
+				decimal.RequireFromString(c.bid), decimal.RequireFromString(c.ask),
+			)
+			if !bid.Equal(decimal.RequireFromString(c.newBid)) {
+				t.Errorf("expected bid %v, got %v", c.newBid, bid)
+			}
+			if !ask.Equal(decimal.RequireFromString(c.newAsk)) {
+				t.Errorf("expected ask %v, got %v", c.newAsk, ask)
+			}
+		})
+	}
+}
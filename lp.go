@@ -0,0 +1,215 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	commandspb "code.vegaprotocol.io/vega/protos/vega/commands/v1"
+	walletpb "code.vegaprotocol.io/vega/protos/vega/wallet/v1"
+	"github.com/shopspring/decimal"
+)
+
+// LPManager keeps our liquidity provision in line with the commitment
+// policy, re-evaluating it periodically.
+type LPManager struct {
+	// shares the spam budget of the key
+	sender    *BatchSender
+	vega      *VegaStore
+	pubkey    string
+	market    string
+	policy    CommitmentPolicy
+	feePolicy FeePolicy
+	// holds the fee updated at runtime
+	strategy *StrategyStore
+	// relative change of the commitment under which we don't amend
+	hysteresis decimal.Decimal
+	interval   time.Duration
+	// cancel the liquidity provision when the bot stops
+	cancelOnExit bool
+
+	mu sync.Mutex
+	// set once the liquidity provision is cancelled,
+	// no need to manage it anymore
+	cancelled bool
+}
+
+func NewLPManager(
+	config *Config,
+	sender *BatchSender,
+	vega *VegaStore,
+	strategy *StrategyStore,
+) *LPManager {
+	return &LPManager{
+		sender:       sender,
+		vega:         vega,
+		pubkey:       config.WalletPubkey,
+		market:       config.VegaMarket,
+		policy:       NewCommitmentPolicy(config),
+		feePolicy:    NewFeePolicy(config),
+		strategy:     strategy,
+		hysteresis:   decimal.RequireFromString(config.LPHysteresis),
+		interval:     config.LPUpdateInterval,
+		cancelOnExit: config.LPCancelOnExit,
+	}
+}
+
+// Run creates or amends the liquidity provision straight away, then
+// keeps it up to date until the market reaches a terminal state.
+func (m *LPManager) Run() {
+	// on failure the bot keeps quoting, the next interval tries again
+	commitmentAmount, err := m.policy.Commitment(m.vega, m.pubkey, m.market)
+	if err != nil {
+		log.Printf("couldn't compute liquidity commitment: %v", err)
+	} else {
+		// then get / create a new liquidity provision
+		fee := m.nominatedFee()
+		err = getOrCreateLPSubmission(m.sender, m.vega, m.market, commitmentAmount, fee)
+		if err != nil {
+			log.Printf("couldn't get or submit liquidity order: %v", err)
+		}
+	}
+
+	for range time.NewTicker(m.interval).C {
+		if m.update() {
+			return
+		}
+	}
+}
+
+// update re-evaluates the liquidity provision, it returns
+// true once there is nothing left to manage.
+func (m *LPManager) update() (done bool) {
+	m.mu.Lock()
+	cancelled := m.cancelled
+	m.mu.Unlock()
+	if cancelled {
+		return true
+	}
+
+	if stale := m.vega.GetStale(); len(stale) > 0 {
+		log.Printf("vega data is stale, not updating the liquidity provision: %v", stale)
+		return false
+	}
+
+	if state := m.vega.GetMarketData().GetMarketState(); isTerminalMarketState(state) {
+		log.Printf("market is in terminal state %v, cancelling liquidity provision", state.String())
+		if err := m.Cancel(); err != nil {
+			return false
+		}
+		return true
+	}
+
+	commitmentAmount, err := m.policy.Commitment(m.vega, m.pubkey, m.market)
+	if err != nil {
+		log.Printf("couldn't compute liquidity commitment: %v", err)
+		return false
+	}
+
+	fee := m.nominatedFee()
+
+	if pending := m.vega.GetPendingLiquidityProvision(); pending != nil {
+		log.Printf("liquidity provision still pending, not amending")
+		return false
+	}
+
+	lp := m.vega.GetLiquidityProvison()
+	if lp == nil {
+		if err := submitNewLP(m.sender, m.vega, m.market, commitmentAmount, fee); err != nil {
+			log.Printf("couldn't submit liquidity provision: %v", err)
+		}
+		return false
+	}
+
+	if m.withinHysteresis(lp, commitmentAmount, fee) {
+		return false
+	}
+
+	if err := maybeAmendLP(m.sender, m.vega, m.market, commitmentAmount, lp, fee); err != nil {
+		log.Printf("couldn't amend liquidity provision: %v", err)
+	}
+	return false
+}
+
+// nominatedFee applies the fee policy using the fee currently
+// set in the strategy parameters.
+func (m *LPManager) nominatedFee() decimal.Decimal {
+	policy := m.feePolicy
+	policy.Fee = m.strategy.GetParams().LPFee
+	return policy.NominatedFee(m.vega, m.pubkey)
+}
+
+// withinHysteresis returns true if the fee is unchanged and the commitment
+// moved less than the hysteresis, in which case we don't amend to avoid churn.
+func (m *LPManager) withinHysteresis(
+	lp *vegapb.LiquidityProvision,
+	commitmentAmount, fee decimal.Decimal,
+) bool {
+	current, err := decimal.NewFromString(lp.CommitmentAmount)
+	if err != nil || !current.IsPositive() {
+		return false
+	}
+
+	if currentFee, err := decimal.NewFromString(lp.Fee); err != nil || !currentFee.Equal(fee) {
+		return false
+	}
+
+	change := commitmentAmount.Sub(current).Abs().Div(current)
+	return change.LessThanOrEqual(m.hysteresis)
+}
+
+// Stop cancels the liquidity provision if configured to do so.
+func (m *LPManager) Stop() {
+	if !m.cancelOnExit {
+		return
+	}
+
+	log.Printf("cancelling liquidity provision before exiting")
+	m.Cancel()
+}
+
+func (m *LPManager) Cancel() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cancelled {
+		return nil
+	}
+	// a provision still pending must be cancelled as well
+	if m.vega.GetLiquidityProvison() == nil && m.vega.GetPendingLiquidityProvision() == nil {
+		return nil
+	}
+
+	cancel := &commandspb.LiquidityProvisionCancellation{
+		MarketId: m.market,
+	}
+
+	err := m.sender.Send(&walletpb.SubmitTransactionRequest{
+		Command: &walletpb.SubmitTransactionRequest_LiquidityProvisionCancellation{
+			LiquidityProvisionCancellation: cancel,
+		},
+	})
+	if err != nil {
+		log.Printf("error submitting liquidity cancellation: %v", err)
+		return err
+	}
+
+	log.Printf("cancellation submitted successfully: %v", cancel.String())
+	m.cancelled = true
+
+	return nil
+}
+
+func isTerminalMarketState(state vegapb.Market_State) bool {
+	switch state {
+	case vegapb.Market_STATE_TRADING_TERMINATED,
+		vegapb.Market_STATE_SETTLED,
+		vegapb.Market_STATE_CLOSED,
+		vegapb.Market_STATE_CANCELLED,
+		vegapb.Market_STATE_REJECTED:
+		return true
+	default:
+		return false
+	}
+}
@@ -1,44 +1,144 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	wallet "github.com/jeremyletang/vega-go-sdk/wallet"
 )
 
 const (
 	defaultAppPort      = 8080
+	defaultAPITimeout   = 10 * time.Second
+	apiShutdownTimeout  = 5 * time.Second
 	defaultWalletURL    = "http://127.0.0.1:1789"
 	defaultVegaGRPCURL  = "n07.testnet.vega.xyz:3007"
 	defaultBinanceWSURL = "wss://stream.binance.com:443/ws"
+	defaultTickSize     = "1"
+	defaultBotID        = "VEGA_GO_MM_SIMPLE"
+	defaultStrategy     = strategyLiquidity
+
+	defaultCommitmentPolicy   = commitmentPolicyBalance
+	defaultCommitmentFraction = "0.1"
+	defaultLPHysteresis       = "0.1"
+	defaultLPUpdateInterval   = time.Minute
+	defaultLPFeePolicy        = feePolicyFixed
+	defaultLPFeeRank          = 1
+
+	defaultFundingSkewFactor = "1"
+	defaultFundingMaxSkew    = "0.002"
+
+	defaultLevelSpacing    = "0.002"
+	defaultLevels          = 5
+	defaultBalanceFraction = "0.9"
+
+	defaultRejectionThreshold = 10
+	defaultMaxBlockLag        = 10
+	defaultMaxDataLag         = 30 * time.Second
 )
 
 var (
-	appPort       uint
+	appPort         uint
+	apiHost         string
+	apiReadTimeout  time.Duration
+	apiWriteTimeout time.Duration
+	apiToken        string
+
 	vegaGRPCURL   string
+	vegaTLS       bool
+	vegaTLSCA     string
+	vegaTLSCert   string
+	vegaTLSKey    string
+	vegaGRPCAuth  string
 	walletURL     string
 	walletToken   string
 	walletPubkey  string
 	binanceWSURL  string
 	vegaMarket    string
 	binanceMarket string
+	markets       string
 	lpFee         string
+	tickSize      string
+	botID         string
+	strategy      string
+
+	commitmentPolicy      string
+	commitmentAmount      string
+	commitmentFraction    string
+	commitmentMarketShare string
+	commitmentMin         string
+	commitmentMax         string
+	lpHysteresis          string
+	lpUpdateInterval      time.Duration
+	lpCancelOnExit        bool
+	lpFeePolicy           string
+	lpFeeRank             uint
+	lpFeeUndercut         string
+	lpFeeMin              string
+	lpFeeMax              string
+
+	fundingSkewFactor string
+	fundingMaxSkew    string
+
+	levelSpacing    string
+	levels          uint
+	balanceFraction string
+
+	rejectionThreshold uint
+	maxBlockLag        uint
+	maxDataLag         time.Duration
 )
 
 func init() {
 	flag.UintVar(&appPort, "port", defaultAppPort, "port of the http API")
-	flag.StringVar(&vegaGRPCURL, "vega-grpc-url", defaultVegaGRPCURL, "a vega grpc server")
+	flag.StringVar(&apiHost, "host", "", "host the http API listens on, all interfaces if empty")
+	flag.DurationVar(&apiReadTimeout, "api-read-timeout", defaultAPITimeout, "maximum duration to read an http API request")
+	flag.DurationVar(&apiWriteTimeout, "api-write-timeout", defaultAPITimeout, "maximum duration to write an http API response")
+	flag.StringVar(&apiToken, "api-token", "", "bearer token required by the http API control endpoints, which are disabled if empty")
+	flag.StringVar(&vegaGRPCURL, "vega-grpc-url", defaultVegaGRPCURL, "a vega grpc server, or a comma separated list of them to fail over between")
+	flag.BoolVar(&vegaTLS, "vega-tls", false, "connect to the vega grpc servers over TLS, using the system roots")
+	flag.StringVar(&vegaTLSCA, "vega-tls-ca", "", "a PEM file with the CA certificates used to verify the vega grpc servers")
+	flag.StringVar(&vegaTLSCert, "vega-tls-cert", "", "a PEM client certificate for the vega grpc servers")
+	flag.StringVar(&vegaTLSKey, "vega-tls-key", "", "the PEM key of the client certificate")
+	flag.StringVar(&vegaGRPCAuth, "vega-grpc-auth", "", "comma separated key=value metadata sent with every request to the vega grpc servers, e.g. authorization=Bearer <token>")
 	flag.StringVar(&walletURL, "wallet-url", defaultWalletURL, "a vega wallet service address")
 	flag.StringVar(&walletToken, "wallet-token", "", "a vega wallet token (for info see vega wallet token-api -h)")
 	flag.StringVar(&walletPubkey, "wallet-pubkey", "", "a vega public key")
 	flag.StringVar(&binanceWSURL, "binance-ws-url", defaultBinanceWSURL, "binance websocket url")
 	flag.StringVar(&vegaMarket, "vega-market", "", "a vega market id")
 	flag.StringVar(&binanceMarket, "binance-market", "", "a binance market symbol")
-	flag.StringVar(&lpFee, "lp-fee", "0.001", "the required fee for the liquidity commitment")
+	flag.StringVar(&markets, "markets", "", "comma separated vegaMarket:binanceMarket[:tickSize[:pubkey[:strategy]]] pairs to trade, instead of -vega-market and -binance-market")
+	flag.StringVar(&lpFee, "lp-fee", "0.001", "the required fee for the liquidity commitment, used as fallback by the other fee policies")
+	flag.StringVar(&tickSize, "tick-size", defaultTickSize, "the market tick size, in market precision")
+	flag.StringVar(&strategy, "strategy", defaultStrategy, "the default strategy: lp to quote and provide liquidity, quote to only quote")
+	flag.StringVar(&botID, "bot-id", defaultBotID, "identifier of the bot, used as prefix of all order references")
+	flag.StringVar(&commitmentPolicy, "commitment-policy", defaultCommitmentPolicy, "how to size the liquidity commitment: fixed, balance or market-share")
+	flag.StringVar(&commitmentAmount, "commitment-amount", "", "the commitment amount, in asset units, for the fixed policy")
+	flag.StringVar(&commitmentFraction, "commitment-fraction", defaultCommitmentFraction, "the fraction of the balance to commit, for the balance policy")
+	flag.StringVar(&commitmentMarketShare, "commitment-market-share", "", "the target share of the total market commitment, for the market-share policy")
+	flag.StringVar(&commitmentMin, "commitment-min", "", "the minimum commitment amount, in asset units")
+	flag.StringVar(&commitmentMax, "commitment-max", "", "the maximum commitment amount, in asset units")
+	flag.StringVar(&lpHysteresis, "lp-hysteresis", defaultLPHysteresis, "relative commitment change under which the liquidity provision is not amended")
+	flag.DurationVar(&lpUpdateInterval, "lp-update-interval", defaultLPUpdateInterval, "how often the liquidity provision is re-evaluated")
+	flag.BoolVar(&lpCancelOnExit, "lp-cancel-on-exit", false, "cancel the liquidity provision when the bot stops")
+	flag.StringVar(&lpFeePolicy, "lp-fee-policy", defaultLPFeePolicy, "how to nominate the liquidity fee: fixed, rank or undercut")
+	flag.UintVar(&lpFeeRank, "lp-fee-rank", defaultLPFeeRank, "the rank of our fee among the other providers, 1 being the cheapest, for the rank policy")
+	flag.StringVar(&lpFeeUndercut, "lp-fee-undercut", "", "how much to undercut the reference fee, for the rank and undercut policies")
+	flag.StringVar(&lpFeeMin, "lp-fee-min", "", "the minimum fee to nominate")
+	flag.StringVar(&lpFeeMax, "lp-fee-max", "", "the maximum fee to nominate")
+	flag.StringVar(&fundingSkewFactor, "funding-skew-factor", defaultFundingSkewFactor, "how much the perpetual funding rate skews the reference prices towards the side receiving funding, 0 to disable")
+	flag.StringVar(&fundingMaxSkew, "funding-max-skew", defaultFundingMaxSkew, "the maximum relative skew applied on the reference prices because of the funding")
+	flag.StringVar(&levelSpacing, "level-spacing", defaultLevelSpacing, "the relative distance between two quote levels, can be updated through the API")
+	flag.UintVar(&levels, "levels", defaultLevels, "the number of quote levels per side, can be updated through the API")
+	flag.StringVar(&balanceFraction, "balance-fraction", defaultBalanceFraction, "the fraction of the balance used to quote, can be updated through the API")
+	flag.UintVar(&rejectionThreshold, "rejection-threshold", defaultRejectionThreshold, "consecutive rejected transactions or orders before backing off")
+	flag.UintVar(&maxBlockLag, "max-block-lag", defaultMaxBlockLag, "blocks a vega node can be behind the most advanced one before failing over")
+	flag.DurationVar(&maxDataLag, "max-data-lag", defaultMaxDataLag, "how far behind the wall clock the vega data can be before we stop quoting")
 }
 
 func main() {
@@ -50,21 +150,35 @@ func main() {
 		log.Fatalf("could not connect to the wallet: %v", err)
 	}
 
-	// share binance reference price for the given market
-	binanceRefPrice := NewBinanceRP(config.BinanceMarket)
+	// connect to the healthiest vega node, and keep checking on them
+	dataNodes := NewDataNodePool(config)
+	go dataNodes.Run()
+
+	// the spam protection limits apply to each key across all markets
+	// map[pubkey]SpamBudget
+	budgets := map[string]*SpamBudget{}
 
-	// listening to the binance data
-	go BinanceAPI(config, binanceRefPrice)
+	// the data shared by the bots is polled once for all of them
+	poller := NewPoller(dataNodes)
 
-	// start the vega API stuff
-	vegaStore := NewVegaStore()
-	VegaAPI(config, vegaStore)
+	// start one bot per key and market pair
+	// map[pubkey]map[market]MarketBot
+	bots := map[string]map[string]*MarketBot{}
+	for _, m := range config.Markets {
+		if _, ok := budgets[m.WalletPubkey]; !ok {
+			budgets[m.WalletPubkey] = NewSpamBudget()
+			bots[m.WalletPubkey] = map[string]*MarketBot{}
+		}
 
-	// start the strategy
-	go RunStrategy(config, w, vegaStore, binanceRefPrice)
+		bot := NewMarketBot(config.ForMarket(m), w, dataNodes, budgets[m.WalletPubkey])
+		bot.Run()
+		bots[m.WalletPubkey][m.VegaMarket] = bot
+		poller.Add(m.WalletPubkey, m.VegaMarket, bot.vega, bot.accounting)
+	}
+	go poller.Run()
 
 	// start the state API
-	go StartAPI(config, vegaStore, binanceRefPrice)
+	server := StartAPI(config, dataNodes, bots)
 
 	// just waiting for users to close
 	gracefulStop := make(chan os.Signal, 1)
@@ -72,4 +186,16 @@ func main() {
 	<-gracefulStop
 
 	log.Print("closing on user request.")
+
+	ctx, cancel := context.WithTimeout(context.Background(), apiShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("could not shut down the state API: %v", err)
+	}
+
+	for _, markets := range bots {
+		for _, bot := range markets {
+			bot.Stop()
+		}
+	}
 }
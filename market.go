@@ -0,0 +1,87 @@
+package main
+
+import (
+	"log"
+
+	"github.com/jeremyletang/vega-go-sdk/wallet"
+)
+
+const (
+	// quote around the reference price and provide liquidity
+	strategyLiquidity = "lp"
+	// only quote around the reference price
+	strategyQuote = "quote"
+)
+
+// MarketBot runs the strategy of one key on one market pair, the data
+// node connection and the wallet client are shared with the other
+// markets, and the spam budget with the other markets of the key.
+type MarketBot struct {
+	config     *Config
+	w          *wallet.Client
+	nodes      *DataNodePool
+	vega       *VegaStore
+	refPrice   *BinanceRP
+	strategy   *StrategyStore
+	tracker    *TxTracker
+	sender     *BatchSender
+	accounting *LPAccounting
+	// nil if the strategy doesn't provide liquidity
+	lp *LPManager
+}
+
+func NewMarketBot(
+	config *Config,
+	w *wallet.Client,
+	nodes *DataNodePool,
+	budget *SpamBudget,
+) *MarketBot {
+	m := &MarketBot{
+		config: config,
+		w:      w,
+		nodes:  nodes,
+		// share binance reference price for the given market
+		refPrice: NewBinanceRP(config.BinanceMarket),
+		// keep track of the transactions sent to the network
+		tracker: NewTxTracker(int(config.RejectionThreshold)),
+		// account for the fees and penalties of our liquidity provision
+		accounting: NewLPAccounting(config.WalletPubkey, config.VegaMarket),
+		vega:       NewVegaStore(),
+		strategy:   NewStrategyStore(NewStrategyParams(config)),
+	}
+
+	// start the vega API stuff
+	VegaAPI(config, nodes, m.vega, m.tracker)
+	if err := validateMarket(config, m.vega); err != nil {
+		log.Fatalf("cannot trade market %v: %v", config.VegaMarket, err)
+	}
+
+	// send the strategy batches within the spam protection limits
+	m.sender = NewBatchSender(w, config.WalletPubkey, m.vega, nodes, m.tracker, budget)
+
+	// keep our liquidity provision up to date
+	if config.Strategy == strategyLiquidity {
+		m.lp = NewLPManager(config, m.sender, m.vega, m.strategy)
+	}
+
+	return m
+}
+
+func (m *MarketBot) Run() {
+	// listening to the binance data
+	go BinanceAPI(m.config, m.refPrice)
+
+	go m.sender.Run()
+	if m.lp != nil {
+		go m.lp.Run()
+	}
+
+	// start the strategy
+	go RunStrategy(m.config, m.nodes, m.vega, m.refPrice, m.strategy, m.tracker, m.sender)
+}
+
+func (m *MarketBot) Stop() {
+	if m.lp != nil {
+		m.lp.Stop()
+	}
+}
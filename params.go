@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	// how many parameter changes we keep
+	maxParamChanges = 100
+	// maximum number of quote levels per side
+	maxLevels = 20
+)
+
+// StrategyParams are the strategy parameters which can be
+// updated at runtime through the HTTP API.
+type StrategyParams struct {
+	// relative distance between two quote levels
+	LevelSpacing decimal.Decimal
+	// number of quote levels per side
+	Levels int
+	// fraction of the balance used to quote
+	BalanceFraction decimal.Decimal
+	// liquidity fee nominated by the fixed fee policy,
+	// and fallback of the other policies
+	LPFee decimal.Decimal
+}
+
+func NewStrategyParams(config *Config) StrategyParams {
+	return StrategyParams{
+		LevelSpacing:    decimal.RequireFromString(config.LevelSpacing),
+		Levels:          int(config.Levels),
+		BalanceFraction: decimal.RequireFromString(config.BalanceFraction),
+		LPFee:           decimal.RequireFromString(config.LPFee),
+	}
+}
+
+// Validate checks the parameters, the LP fee must
+// also be within the bounds of the fee policy.
+func (p StrategyParams) Validate(fees FeePolicy) error {
+	if !p.LevelSpacing.IsPositive() || p.LevelSpacing.GreaterThan(decimal.NewFromFloat(0.1)) {
+		return errors.New("level spacing must be in (0, 0.1]")
+	}
+	if p.Levels < 1 || p.Levels > maxLevels {
+		return fmt.Errorf("levels must be in [1, %v]", maxLevels)
+	}
+	if !p.BalanceFraction.IsPositive() || p.BalanceFraction.GreaterThan(decimal.NewFromInt(1)) {
+		return errors.New("balance fraction must be in (0, 1]")
+	}
+	if p.LPFee.IsNegative() || p.LPFee.GreaterThanOrEqual(decimal.NewFromInt(1)) {
+		return errors.New("LP fee must be in [0, 1)")
+	}
+	if fees.Min.IsPositive() && p.LPFee.LessThan(fees.Min) {
+		return fmt.Errorf("LP fee must not be below the minimum fee %v", fees.Min)
+	}
+	if fees.Max.IsPositive() && p.LPFee.GreaterThan(fees.Max) {
+		return fmt.Errorf("LP fee must not be above the maximum fee %v", fees.Max)
+	}
+	return nil
+}
+
+// ParamsUpdate only changes the parameters which are set.
+type ParamsUpdate struct {
+	LevelSpacing    *decimal.Decimal
+	Levels          *int
+	BalanceFraction *decimal.Decimal
+	LPFee           *decimal.Decimal
+}
+
+func (u ParamsUpdate) apply(p StrategyParams) StrategyParams {
+	if u.LevelSpacing != nil {
+		p.LevelSpacing = *u.LevelSpacing
+	}
+	if u.Levels != nil {
+		p.Levels = *u.Levels
+	}
+	if u.BalanceFraction != nil {
+		p.BalanceFraction = *u.BalanceFraction
+	}
+	if u.LPFee != nil {
+		p.LPFee = *u.LPFee
+	}
+	return p
+}
+
+// ParamChange records an update of the parameters for audit.
+type ParamChange struct {
+	At     time.Time
+	Caller string
+	Old    StrategyParams
+	New    StrategyParams
+	// set once the strategy uses the new parameters
+	AppliedAt *time.Time
+}
+
+// ParamsState is returned by the /params endpoint.
+type ParamsState struct {
+	Params StrategyParams
+	// waiting for the next strategy execution
+	Pending *StrategyParams
+	History []ParamChange
+}
+
+// UpdateParams validates the update against the latest parameters,
+// including the pending ones, and queues the result for the next
+// strategy execution.
+func (s *StrategyStore) UpdateParams(u ParamsUpdate, fees FeePolicy, caller string) (StrategyParams, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := s.params
+	if s.pendingParams != nil {
+		current = *s.pendingParams
+	}
+
+	updated := u.apply(current)
+	if err := updated.Validate(fees); err != nil {
+		return StrategyParams{}, err
+	}
+
+	s.pendingParams = &updated
+	s.paramChanges = append(s.paramChanges, ParamChange{
+		At:     time.Now(),
+		Caller: caller,
+		Old:    current,
+		New:    updated,
+	})
+	if len(s.paramChanges) > maxParamChanges {
+		s.paramChanges = s.paramChanges[len(s.paramChanges)-maxParamChanges:]
+	}
+
+	return updated, nil
+}
+
+// takeParams applies the pending parameters if any,
+// and returns the parameters to use.
+func (s *StrategyStore) takeParams() StrategyParams {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pendingParams != nil {
+		log.Printf("applying new strategy parameters: %+v", *s.pendingParams)
+		s.params = *s.pendingParams
+		s.pendingParams = nil
+
+		now := time.Now()
+		for i := range s.paramChanges {
+			if s.paramChanges[i].AppliedAt == nil {
+				s.paramChanges[i].AppliedAt = &now
+			}
+		}
+	}
+
+	return s.params
+}
+
+// GetParams returns the parameters in use.
+func (s *StrategyStore) GetParams() StrategyParams {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.params
+}
+
+func (s *StrategyStore) GetParamsState() ParamsState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	state := ParamsState{
+		Params:  s.params,
+		History: slices.Clone(s.paramChanges),
+	}
+	if s.pendingParams != nil {
+		pending := *s.pendingParams
+		state.Pending = &pending
+	}
+	return state
+}
+
+// paramsHandler returns the parameters of the bots on GET, and updates them
+// on PUT. Both are restricted to the bots selected by the optional pubkey
+// and market query parameters, and the updates require the API token.
+func paramsHandler(
+	config *Config,
+	bots map[string]map[string]*MarketBot,
+) http.HandlerFunc {
+	// held from the validation to the update of all the
+	// bots, so concurrent updates can't fail half way
+	var mu sync.Mutex
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		selected := selectBots(bots, r)
+		if len(selected) <= 0 {
+			http.Error(w, "no matching market", http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			state := map[string]map[string]ParamsState{}
+			for pubkey, markets := range selected {
+				state[pubkey] = map[string]ParamsState{}
+				for id, bot := range markets {
+					state[pubkey][id] = bot.strategy.GetParamsState()
+				}
+			}
+
+			out, _ := json.Marshal(&state)
+			fmt.Fprintf(w, "%v", string(out))
+		case http.MethodPut:
+			if !authorized(config, w, r) {
+				return
+			}
+
+			update := ParamsUpdate{}
+			// a misspelt field must not be silently ignored
+			dec := json.NewDecoder(r.Body)
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&update); err != nil {
+				http.Error(w, fmt.Sprintf("invalid parameters: %v", err), http.StatusBadRequest)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			// validate everything first so the update applies to all or none
+			for _, markets := range selected {
+				for id, bot := range markets {
+					current := bot.strategy.GetParamsState()
+					base := current.Params
+					if current.Pending != nil {
+						base = *current.Pending
+					}
+					if err := update.apply(base).Validate(NewFeePolicy(bot.config)); err != nil {
+						http.Error(w, fmt.Sprintf("invalid parameters for market %v: %v", id, err), http.StatusBadRequest)
+						return
+					}
+				}
+			}
+
+			caller := r.RemoteAddr
+			if operator := r.Header.Get("X-Operator"); len(operator) > 0 {
+				caller = fmt.Sprintf("%v (%v)", operator, r.RemoteAddr)
+			}
+
+			updated := map[string]map[string]StrategyParams{}
+			for pubkey, markets := range selected {
+				updated[pubkey] = map[string]StrategyParams{}
+				for id, bot := range markets {
+					params, err := bot.strategy.UpdateParams(update, NewFeePolicy(bot.config), caller)
+					if err != nil {
+						http.Error(w, fmt.Sprintf("invalid parameters for market %v: %v", id, err), http.StatusBadRequest)
+						return
+					}
+					updated[pubkey][id] = params
+					log.Printf("strategy parameters of %v/%v updated by %v: %+v", pubkey, id, caller, params)
+				}
+			}
+
+			out, _ := json.Marshal(&updated)
+			fmt.Fprintf(w, "%v", string(out))
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"code.vegaprotocol.io/vega/libs/ptr"
+	apipb "code.vegaprotocol.io/vega/protos/data-node/api/v2"
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+)
+
+// Poller polls the data shared by several bots once per process rather
+// than once per bot: the markets and all their liquidity provisions once
+// per market, and our ledger entries once per key.
+type Poller struct {
+	nodes *DataNodePool
+	// map[market][]VegaStore
+	stores map[string][]*VegaStore
+	// map[pubkey][]LPAccounting
+	accounting map[string][]*LPAccounting
+}
+
+func NewPoller(nodes *DataNodePool) *Poller {
+	return &Poller{
+		nodes:      nodes,
+		stores:     map[string][]*VegaStore{},
+		accounting: map[string][]*LPAccounting{},
+	}
+}
+
+// Add registers the store and the accounting of a bot,
+// all the bots must be added before calling Run.
+func (p *Poller) Add(pubkey, market string, store *VegaStore, accounting *LPAccounting) {
+	p.stores[market] = append(p.stores[market], store)
+	p.accounting[pubkey] = append(p.accounting[pubkey], accounting)
+}
+
+func (p *Poller) Run() {
+	for pubkey, accounting := range p.accounting {
+		go p.pollLedgerEntries(pubkey, accounting)
+	}
+	p.pollMarketLPs()
+}
+
+// pollMarketLPs refreshes the markets and all their liquidity provisions,
+// these are used to find out the fees nominated by the other providers.
+func (p *Poller) pollMarketLPs() {
+	for range time.NewTicker(30 * time.Second).C {
+		for market, stores := range p.stores {
+			svc, _ := p.nodes.Client()
+			mkt, err := svc.GetMarket(context.Background(), &apipb.GetMarketRequest{MarketId: market})
+			if err != nil {
+				log.Printf("could not load market: %v", err)
+			} else {
+				for _, s := range stores {
+					s.SetMarket(mkt.Market)
+				}
+			}
+
+			lps, err := loadMarketLPs(p.nodes, market)
+			if err != nil {
+				log.Printf("could not load market liquidity provisions: %v", err)
+				continue
+			}
+			for _, s := range stores {
+				s.SetMarketLiquidityProvisions(lps)
+			}
+		}
+	}
+}
+
+// pollLedgerEntries periodically loads the ledger entries related to the
+// liquidity provisions of the key, starting from the epoch during which the
+// bot started. Each accounting only keeps the entries of its own market.
+func (p *Poller) pollLedgerEntries(pubkey string, accounting []*LPAccounting) {
+	var (
+		since int64
+		// where the previous page of entries ended
+		cursor string
+		epochs = epochStarts{}
+		last   uint64
+	)
+	for range time.NewTicker(30 * time.Second).C {
+		epoch, err := p.loadEpoch(nil)
+		if err != nil {
+			log.Printf("could not load current epoch: %v", err)
+			continue
+		}
+
+		seq := epoch.GetSeq()
+		if since == 0 {
+			since = epoch.GetTimestamps().GetStartTime()
+			last = seq
+		}
+		epochs[seq] = epoch.GetTimestamps().GetStartTime()
+
+		// we need the start of every epoch, even the ones which went by
+		// between two polls, the entries wait until we have them all
+		for ; last+1 < seq; last++ {
+			missed, err := p.loadEpoch(ptr.From(last + 1))
+			if err != nil {
+				log.Printf("could not load epoch %v: %v", last+1, err)
+				break
+			}
+			epochs[last+1] = missed.GetTimestamps().GetStartTime()
+		}
+		if last+1 < seq {
+			continue
+		}
+		last = seq
+
+		entries, next, err := loadLedgerEntries(p.nodes, pubkey, since, cursor)
+		if err != nil {
+			log.Printf("could not load ledger entries: %v", err)
+			continue
+		}
+		cursor = next
+
+		for _, a := range accounting {
+			a.OnLedgerEntries(epochs, entries)
+		}
+
+		// forget about the epochs older than the accounting history
+		for s := range epochs {
+			if s+maxAccountingEpochs < seq {
+				delete(epochs, s)
+			}
+		}
+	}
+}
+
+// loadEpoch returns the given epoch, the current one if nil.
+func (p *Poller) loadEpoch(id *uint64) (*vegapb.Epoch, error) {
+	svc, _ := p.nodes.Client()
+	resp, err := svc.GetEpoch(context.Background(), &apipb.GetEpochRequest{Id: id})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Epoch, nil
+}
+
+func loadMarketLPs(nodes *DataNodePool, market string) ([]*vegapb.LiquidityProvision, error) {
+	svc, _ := nodes.Client()
+	resp, err := svc.ListLiquidityProvisions(context.Background(), &apipb.ListLiquidityProvisionsRequest{
+		MarketId: ptr.From(market),
+		Live:     ptr.From(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lps := []*vegapb.LiquidityProvision{}
+	for _, e := range resp.LiquidityProvisions.Edges {
+		lps = append(lps, e.Node)
+	}
+	return lps, nil
+}
+
+// loadLedgerEntries returns the entries after the cursor, all of them since
+// the given time if the cursor is empty, and the cursor of the last entry.
+func loadLedgerEntries(
+	nodes *DataNodePool,
+	pubkey string,
+	since int64,
+	cursor string,
+) ([]*apipb.AggregatedLedgerEntry, string, error) {
+	req := &apipb.ListLedgerEntriesRequest{
+		Filter: &apipb.LedgerEntryFilter{
+			FromAccountFilter: &apipb.AccountFilter{PartyIds: []string{pubkey}},
+			ToAccountFilter:   &apipb.AccountFilter{PartyIds: []string{pubkey}},
+			TransferTypes:     ledgerTransferTypes,
+		},
+		DateRange: &apipb.DateRange{StartTimestamp: ptr.From(since)},
+		Pagination: &apipb.Pagination{
+			NewestFirst: ptr.From(false),
+		},
+	}
+	if len(cursor) > 0 {
+		req.Pagination.After = ptr.From(cursor)
+	}
+
+	entries := []*apipb.AggregatedLedgerEntry{}
+	for {
+		svc, _ := nodes.Client()
+		resp, err := svc.ListLedgerEntries(context.Background(), req)
+		if err != nil {
+			return nil, "", err
+		}
+
+		for _, e := range resp.LedgerEntries.Edges {
+			entries = append(entries, e.Node)
+		}
+		// entries sharing a timestamp are not skipped,
+		// unlike when starting after the last timestamp
+		if end := resp.LedgerEntries.GetPageInfo().GetEndCursor(); len(end) > 0 {
+			cursor = end
+		}
+
+		if !resp.LedgerEntries.GetPageInfo().GetHasNextPage() {
+			return entries, cursor, nil
+		}
+		req.Pagination.After = ptr.From(cursor)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	commandspb "code.vegaprotocol.io/vega/protos/vega/commands/v1"
+)
+
+// OrderIntent is what the strategy meant to do when
+// submitting an order with a given reference.
+type OrderIntent struct {
+	Reference string
+	Batch     string
+	Side      string
+	Level     int
+	Price     string
+	Size      uint64
+	// size filled so far
+	Filled    uint64
+	CreatedAt time.Time
+}
+
+// LevelStats aggregates the orders and fills for a quote level.
+type LevelStats struct {
+	Side       string
+	Level      int
+	Orders     uint64
+	Rejected   uint64
+	Fills      uint64
+	FilledSize uint64
+}
+
+// newBatchReference builds the reference shared by all orders of a batch:
+// <bot id>-<batch sequence>
+func newBatchReference(botID string, seq uint64) string {
+	return fmt.Sprintf("%v-%d", botID, seq)
+}
+
+// newOrderReference builds the reference for a single quote level:
+// <bot id>-<batch sequence>-<B|S>-<level>
+func newOrderReference(batch string, side vegapb.Side, level int) string {
+	s := "B"
+	if side == vegapb.Side_SIDE_SELL {
+		s = "S"
+	}
+	return fmt.Sprintf("%v-%v-%d", batch, s, level)
+}
+
+// parseOrderReference splits an order reference into the batch reference
+// it belongs to, the side and the level. The bot id is allowed to contain
+// dashes so the reference is parsed from the end.
+func parseOrderReference(ref string) (batch string, side vegapb.Side, level int, ok bool) {
+	parts := strings.Split(ref, "-")
+	if len(parts) < 4 {
+		return "", vegapb.Side_SIDE_UNSPECIFIED, 0, false
+	}
+
+	level, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil {
+		return "", vegapb.Side_SIDE_UNSPECIFIED, 0, false
+	}
+
+	switch parts[len(parts)-2] {
+	case "B":
+		side = vegapb.Side_SIDE_BUY
+	case "S":
+		side = vegapb.Side_SIDE_SELL
+	default:
+		return "", vegapb.Side_SIDE_UNSPECIFIED, 0, false
+	}
+
+	if _, err := strconv.ParseUint(parts[len(parts)-3], 10, 64); err != nil {
+		return "", vegapb.Side_SIDE_UNSPECIFIED, 0, false
+	}
+
+	return strings.Join(parts[:len(parts)-2], "-"), side, level, true
+}
+
+// newOrderIntents records the intent of every submission of a batch.
+func newOrderIntents(batch string, submissions []*commandspb.OrderSubmission) []*OrderIntent {
+	now := time.Now()
+	intents := make([]*OrderIntent, 0, len(submissions))
+	for _, s := range submissions {
+		_, side, level, ok := parseOrderReference(s.Reference)
+		if !ok {
+			continue
+		}
+
+		intents = append(intents, &OrderIntent{
+			Reference: s.Reference,
+			Batch:     batch,
+			Side:      side.String(),
+			Level:     level,
+			Price:     s.Price,
+			Size:      s.Size,
+			CreatedAt: now,
+		})
+	}
+
+	return intents
+}
+
+func levelKey(side string, level int) string {
+	return fmt.Sprintf("%v-%d", side, level)
+}
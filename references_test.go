@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+)
+
+func TestParseOrderReference(t *testing.T) {
+	cases := []struct {
+		name  string
+		ref   string
+		batch string
+		side  vegapb.Side
+		level int
+		ok    bool
+	}{
+		{"buy level", "bot-12-B-0", "bot-12", vegapb.Side_SIDE_BUY, 0, true},
+		{"sell level", "bot-12-S-3", "bot-12", vegapb.Side_SIDE_SELL, 3, true},
+		{"bot id with dashes", "my-mm-bot-7-B-2", "my-mm-bot-7", vegapb.Side_SIDE_BUY, 2, true},
+		{"too few parts", "12-B-0", "", vegapb.Side_SIDE_UNSPECIFIED, 0, false},
+		{"unknown side", "bot-12-X-0", "", vegapb.Side_SIDE_UNSPECIFIED, 0, false},
+		{"level not a number", "bot-12-B-x", "", vegapb.Side_SIDE_UNSPECIFIED, 0, false},
+		{"sequence not a number", "bot-x-B-0", "", vegapb.Side_SIDE_UNSPECIFIED, 0, false},
+		{"not ours", "some-other-reference", "", vegapb.Side_SIDE_UNSPECIFIED, 0, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			batch, side, level, ok := parseOrderReference(c.ref)
+			if ok != c.ok || batch != c.batch || side != c.side || level != c.level {
+				t.Errorf("expected (%v, %v, %v, %v), got (%v, %v, %v, %v)",
+					c.batch, c.side, c.level, c.ok, batch, side, level, ok)
+			}
+		})
+	}
+}
+
+func TestOrderReferenceRoundTrip(t *testing.T) {
+	cases := []struct {
+		name  string
+		botID string
+		seq   uint64
+		side  vegapb.Side
+		level int
+	}{
+		{"buy", "bot", 1, vegapb.Side_SIDE_BUY, 0},
+		{"sell", "bot", 42, vegapb.Side_SIDE_SELL, 9},
+		{"bot id with dashes", "my-mm-bot", 7, vegapb.Side_SIDE_SELL, 1},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			batch := newBatchReference(c.botID, c.seq)
+			gotBatch, side, level, ok := parseOrderReference(newOrderReference(batch, c.side, c.level))
+			if !ok || gotBatch != batch || side != c.side || level != c.level {
+				t.Errorf("expected (%v, %v, %v), got (%v, %v, %v, %v)",
+					batch, c.side, c.level, gotBatch, side, level, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"log"
+
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	commandspb "code.vegaprotocol.io/vega/protos/vega/commands/v1"
+	"github.com/shopspring/decimal"
+)
+
+// SLAStatus reports how the bot is doing regarding
+// its liquidity commitment obligations.
+type SLAStatus struct {
+	// fraction of the current epoch our orders
+	// spent on the book within the liquidity range
+	FractionOfTimeOnBook string
+	// minimum fraction required by the market
+	CommitmentMinTimeFraction string
+	// notional volume required on each side
+	RequiredLiquidity string
+	// notional volume quoted on each side
+	// within the liquidity price range
+	BuyVolumeInRange  string
+	SellVolumeInRange string
+	// liquidity price range in market precision
+	RangeMin string
+	RangeMax string
+	// true if we are projected to miss the commitment
+	BelowTarget bool
+}
+
+func getSLAStatus(
+	mkt *vegapb.Market,
+	sla *vegapb.LiquidityProviderSLA,
+	r liquidityRange,
+	required, buyInRange, sellInRange decimal.Decimal,
+) SLAStatus {
+	status := SLAStatus{
+		FractionOfTimeOnBook:      sla.GetCurrentEpochFractionOfTimeOnBook(),
+		CommitmentMinTimeFraction: mkt.GetLiquiditySlaParams().GetCommitmentMinTimeFraction(),
+		RequiredLiquidity:         required.String(),
+		BuyVolumeInRange:          buyInRange.String(),
+		SellVolumeInRange:         sellInRange.String(),
+		RangeMin:                  r.min.String(),
+		RangeMax:                  r.max.String(),
+	}
+
+	if required.IsPositive() && (buyInRange.LessThan(required) || sellInRange.LessThan(required)) {
+		status.BelowTarget = true
+	}
+
+	// we take the fraction of time on book so far as the projection for the
+	// end of the epoch, assuming we'll keep quoting until then.
+	fraction, err := decimal.NewFromString(status.FractionOfTimeOnBook)
+	target, terr := decimal.NewFromString(status.CommitmentMinTimeFraction)
+	if err == nil && terr == nil && fraction.LessThan(target) {
+		status.BelowTarget = true
+	}
+
+	if status.BelowTarget {
+		log.Printf("ALERT: projected SLA below target: timeOnBook(%v) target(%v) required(%v) buyInRange(%v) sellInRange(%v)",
+			status.FractionOfTimeOnBook, status.CommitmentMinTimeFraction, status.RequiredLiquidity,
+			status.BuyVolumeInRange, status.SellVolumeInRange,
+		)
+	}
+
+	return status
+}
+
+// liquidityRange is the price range, in market precision, in which
+// our orders count toward the liquidity commitment.
+type liquidityRange struct {
+	min decimal.Decimal
+	max decimal.Decimal
+	ok  bool
+}
+
+func getCurrentSLAStats(
+	vega *VegaStore,
+	pubkey string,
+) *vegapb.LiquidityProviderSLA {
+	for _, v := range vega.GetMarketData().GetLiquidityProviderSla() {
+		if v.Party == pubkey {
+			log.Printf("current SLA stats: %v", v.String())
+			return v
+		}
+	}
+
+	log.Printf("no SLA stats available yet...")
+	return nil
+}
+
+// getLiquidityRange returns the SLA price range around the mid price of
+// the market, the reference mid price is used if the market have none.
+func getLiquidityRange(
+	d decimals,
+	mkt *vegapb.Market,
+	md *vegapb.MarketData,
+	refMid decimal.Decimal,
+) (r liquidityRange) {
+	priceRange, err := decimal.NewFromString(mkt.GetLiquiditySlaParams().GetPriceRange())
+	if err != nil || !priceRange.IsPositive() {
+		return r
+	}
+
+	mid, err := decimal.NewFromString(md.GetMidPrice())
+	if err != nil || !mid.IsPositive() {
+		mid = d.ToMarketPricePrecision(refMid)
+	}
+	if !mid.IsPositive() {
+		return r
+	}
+
+	one := decimal.NewFromInt(1)
+	return liquidityRange{
+		min: mid.Mul(one.Sub(priceRange)),
+		max: mid.Mul(one.Add(priceRange)),
+		ok:  true,
+	}
+}
+
+func (r liquidityRange) Contains(price decimal.Decimal) bool {
+	return r.ok && price.GreaterThanOrEqual(r.min) && price.LessThanOrEqual(r.max)
+}
+
+// getRequiredLiquidity returns the notional volume, in asset units, we need
+// on each side of the book. It is taken from the SLA stats when available,
+// or derived from our commitment otherwise.
+func getRequiredLiquidity(
+	vega *VegaStore,
+	sla *vegapb.LiquidityProviderSLA,
+	assetDecimals uint64,
+) decimal.Decimal {
+	assetFactor := decimal.NewFromInt(10).Pow(decimal.NewFromInt(int64(assetDecimals)))
+
+	if required, err := decimal.NewFromString(sla.GetRequiredLiquidity()); err == nil && required.IsPositive() {
+		return required.Div(assetFactor)
+	}
+
+	lp := vega.GetLiquidityProvison()
+	if lp == nil {
+		return decimal.Zero
+	}
+
+	commitment, err := decimal.NewFromString(lp.CommitmentAmount)
+	if err != nil {
+		return decimal.Zero
+	}
+
+	stakeToVolume := decimal.NewFromInt(1)
+	if v, ok := vega.GetNetworkParameter(netParamStakeToCcyVolume); ok {
+		if s, err := decimal.NewFromString(v); err == nil {
+			stakeToVolume = s
+		}
+	}
+
+	return commitment.Mul(stakeToVolume).Div(assetFactor)
+}
+
+// ensureSLAVolume makes sure the orders of one side carry at least the required
+// notional volume within the liquidity range. Volume is first moved from the
+// levels outside of the range to the best level inside it, then the best level
+// is increased if that's still not enough, without the whole side going over
+// maxVolume. It returns the updated orders with the notional volume now within
+// the range.
+func ensureSLAVolume(
+	d decimals,
+	orders []*commandspb.OrderSubmission,
+	side vegapb.Side,
+	r liquidityRange,
+	bounds priceBounds,
+	required, maxVolume decimal.Decimal,
+) ([]*commandspb.OrderSubmission, decimal.Decimal) {
+	price := func(o *commandspb.OrderSubmission) decimal.Decimal {
+		p, _ := decimal.NewFromString(o.Price)
+		return p
+	}
+	notional := func(o *commandspb.OrderSubmission) decimal.Decimal {
+		return d.FromMarketPricePrecision(price(o)).
+			Mul(d.FromMarketPositionPrecision(decimal.NewFromInt(int64(o.Size))))
+	}
+	inRange := func() decimal.Decimal {
+		return volumeInRange(d, orders, r)
+	}
+
+	if !r.ok || len(orders) <= 0 || !required.IsPositive() {
+		return orders, inRange()
+	}
+
+	// orders are sorted from the best level to the worst one,
+	// so the first one in range is the best.
+	best := -1
+	for i, o := range orders {
+		if r.Contains(price(o)) {
+			best = i
+			break
+		}
+	}
+
+	// none of our levels are in range, move the best one to the edge of the
+	// range, as long as it stays within the price monitoring bounds
+	if best < 0 {
+		edge := d.AlignToTick(r.min, true)
+		if side == vegapb.Side_SIDE_SELL {
+			edge = d.AlignToTick(r.max, false)
+		}
+		edge, drop := bounds.AlignToTick(d).Clamp(side, edge)
+		if drop || !r.Contains(edge) {
+			log.Printf("no %v price within both the liquidity range and the price monitoring bounds", side.String())
+			return orders, inRange()
+		}
+		for _, o := range orders {
+			if price(o).Equal(edge) {
+				log.Printf("%v price %v already used, not moving level 1", side.String(), edge)
+				return orders, inRange()
+			}
+		}
+
+		best = 0
+		log.Printf("no %v level within the liquidity range, moving level 1 from %v to %v", side.String(), orders[0].Price, edge)
+		orders[0].Price = edge.String()
+	}
+
+	gap := required.Sub(inRange())
+	if !gap.IsPositive() {
+		return orders, inRange()
+	}
+	bestOrder := orders[best]
+	bestPrice := d.FromMarketPricePrecision(price(bestOrder))
+
+	// move the volume from the worst levels out of range to the best level
+	out := []*commandspb.OrderSubmission{}
+	for i := len(orders) - 1; i >= 0; i-- {
+		o := orders[i]
+		if !gap.IsPositive() || o == bestOrder || r.Contains(price(o)) {
+			out = append([]*commandspb.OrderSubmission{o}, out...)
+			continue
+		}
+
+		log.Printf("moving %v order %v volume (%v) within the liquidity range", side.String(), o.Reference, o.Size)
+		bestOrder.Size += o.Size
+		gap = gap.Sub(bestPrice.Mul(d.FromMarketPositionPrecision(decimal.NewFromInt(int64(o.Size)))))
+	}
+	orders = out
+
+	if gap.IsPositive() {
+		missing := d.ToMarketPositionPrecision(gap.Div(bestPrice)).Ceil()
+
+		// we can't quote more than the volume available for the side
+		total := decimal.Zero
+		for _, o := range orders {
+			total = total.Add(notional(o))
+		}
+		available := d.ToMarketPositionPrecision(maxVolume.Sub(total).Div(bestPrice)).Floor()
+		if missing.GreaterThan(available) {
+			log.Printf("not enough %v volume available to cover the liquidity commitment", side.String())
+			missing = available
+		}
+
+		if missing.IsPositive() {
+			log.Printf("adding %v to %v best level to cover the liquidity commitment", missing, side.String())
+			bestOrder.Size += missing.BigInt().Uint64()
+		}
+	}
+
+	return orders, inRange()
+}
+
+// volumeInRange returns the notional volume of the orders
+// within the liquidity range, in asset units.
+func volumeInRange(
+	d decimals,
+	orders []*commandspb.OrderSubmission,
+	r liquidityRange,
+) (v decimal.Decimal) {
+	for _, o := range orders {
+		price, _ := decimal.NewFromString(o.Price)
+		if r.Contains(price) {
+			v = v.Add(d.FromMarketPricePrecision(price).
+				Mul(d.FromMarketPositionPrecision(decimal.NewFromInt(int64(o.Size)))))
+		}
+	}
+	return v
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"testing"
+
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	commandspb "code.vegaprotocol.io/vega/protos/vega/commands/v1"
+	"github.com/shopspring/decimal"
+)
+
+type testOrder struct {
+	price string
+	size  uint64
+}
+
+func testOrders(orders ...testOrder) []*commandspb.OrderSubmission {
+	out := []*commandspb.OrderSubmission{}
+	for _, o := range orders {
+		out = append(out, &commandspb.OrderSubmission{Price: o.price, Size: o.size})
+	}
+	return out
+}
+
+func testRange(min, max string) liquidityRange {
+	return liquidityRange{
+		min: decimal.RequireFromString(min),
+		max: decimal.RequireFromString(max),
+		ok:  true,
+	}
+}
+
+func TestEnsureSLAVolume(t *testing.T) {
+	cases := []struct {
+		name      string
+		orders    []*commandspb.OrderSubmission
+		side      vegapb.Side
+		r         liquidityRange
+		bounds    priceBounds
+		required  string
+		maxVolume string
+		expected  []testOrder
+		inRange   string
+	}{
+		{
+			"enough volume in range",
+			testOrders(testOrder{"100", 1}, testOrder{"95", 1}, testOrder{"80", 2}),
+			vegapb.Side_SIDE_BUY, testRange("90", "110"), priceBounds{}, "150", "1000",
+			[]testOrder{{"100", 1}, {"95", 1}, {"80", 2}}, "195",
+		},
+		{
+			"nothing required",
+			testOrders(testOrder{"80", 1}),
+			vegapb.Side_SIDE_BUY, testRange("90", "110"), priceBounds{}, "0", "1000",
+			[]testOrder{{"80", 1}}, "0",
+		},
+		{
+			"no liquidity range",
+			testOrders(testOrder{"80", 1}),
+			vegapb.Side_SIDE_BUY, liquidityRange{}, priceBounds{}, "100", "1000",
+			[]testOrder{{"80", 1}}, "0",
+		},
+		{
+			"volume out of range moved to the best level",
+			testOrders(testOrder{"100", 1}, testOrder{"95", 1}, testOrder{"80", 2}),
+			vegapb.Side_SIDE_BUY, testRange("90", "110"), priceBounds{}, "300", "1000",
+			[]testOrder{{"100", 3}, {"95", 1}}, "395",
+		},
+		{
+			"best level increased",
+			testOrders(testOrder{"100", 1}, testOrder{"95", 1}, testOrder{"80", 2}),
+			vegapb.Side_SIDE_BUY, testRange("90", "110"), priceBounds{}, "500", "1000",
+			[]testOrder{{"100", 5}, {"95", 1}}, "595",
+		},
+		{
+			"best level increase capped by max volume",
+			testOrders(testOrder{"100", 1}, testOrder{"95", 1}, testOrder{"80", 2}),
+			vegapb.Side_SIDE_BUY, testRange("90", "110"), priceBounds{}, "500", "500",
+			[]testOrder{{"100", 4}, {"95", 1}}, "495",
+		},
+		{
+			"bid moved to the edge of the range",
+			testOrders(testOrder{"80", 1}, testOrder{"70", 1}),
+			vegapb.Side_SIDE_BUY, testRange("90", "110"), priceBounds{}, "100", "1000",
+			[]testOrder{{"90", 2}}, "180",
+		},
+		{
+			"offer moved to the edge of the range",
+			testOrders(testOrder{"120", 1}, testOrder{"130", 1}),
+			vegapb.Side_SIDE_SELL, testRange("90", "110"), priceBounds{}, "100", "1000",
+			[]testOrder{{"110", 1}, {"130", 1}}, "110",
+		},
+		{
+			"edge of the range outside of the price bounds",
+			testOrders(testOrder{"80", 1}, testOrder{"70", 1}),
+			vegapb.Side_SIDE_BUY, testRange("90", "110"),
+			priceBounds{min: decimal.Zero, max: decimal.NewFromInt(85), ok: true}, "100", "1000",
+			[]testOrder{{"80", 1}, {"70", 1}}, "0",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orders, inRange := ensureSLAVolume(
+				testDecimals(0, 0, "1"), c.orders, c.side, c.r, c.bounds,
+				decimal.RequireFromString(c.required), decimal.RequireFromString(c.maxVolume),
+			)
+			if !inRange.Equal(decimal.RequireFromString(c.inRange)) {
+				t.Errorf("expected %v in range, got %v", c.inRange, inRange)
+			}
+			if len(orders) != len(c.expected) {
+				t.Fatalf("expected %v orders, got %v", len(c.expected), len(orders))
+			}
+			for i, o := range orders {
+				if o.Price != c.expected[i].price || o.Size != c.expected[i].size {
+					t.Errorf("order %v: expected %v, got %v@%v", i, c.expected[i], o.Size, o.Price)
+				}
+			}
+		})
+	}
+}
+
+func TestVolumeInRange(t *testing.T) {
+	cases := []struct {
+		name     string
+		d        decimals
+		orders   []*commandspb.OrderSubmission
+		r        liquidityRange
+		expected string
+	}{
+		{
+			"only the levels in range",
+			testDecimals(0, 0, "1"),
+			testOrders(testOrder{"100", 1}, testOrder{"95", 2}, testOrder{"80", 3}),
+			testRange("90", "110"), "290",
+		},
+		{
+			"range bounds included",
+			testDecimals(0, 0, "1"),
+			testOrders(testOrder{"90", 1}, testOrder{"110", 1}),
+			testRange("90", "110"), "200",
+		},
+		{
+			"no liquidity range",
+			testDecimals(0, 0, "1"),
+			testOrders(testOrder{"100", 1}),
+			liquidityRange{}, "0",
+		},
+		{
+			"market precision",
+			testDecimals(2, 1, "1"),
+			testOrders(testOrder{"10000", 15}),
+			testRange("9000", "11000"), "150",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := volumeInRange(c.d, c.orders, c.r)
+			if !got.Equal(decimal.RequireFromString(c.expected)) {
+				t.Errorf("expected %v, got %v", c.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	commandspb "code.vegaprotocol.io/vega/protos/vega/commands/v1"
+	walletpb "code.vegaprotocol.io/vega/protos/vega/wallet/v1"
+	"github.com/jeremyletang/vega-go-sdk/wallet"
+)
+
+// how often the sender checks if it can send queued transactions
+const batchSenderInterval = 200 * time.Millisecond
+
+// SpamStats summarises how the bot uses its spam protection budget.
+type SpamStats struct {
+	BlockHeight   uint64
+	TxPerBlock    uint64
+	MaxBatchSize  uint64
+	SentThisBlock uint64
+	QueuedParts   int
+	SplitBatches  uint64
+	Coalesced     uint64
+	Delayed       uint64
+}
+
+// SpamBudget counts the transactions sent per block by a public key,
+// it's shared by all the senders using the key as the spam protection
+// limits apply to the key, whatever the market.
+type SpamBudget struct {
+	mu sync.Mutex
+	// map[blockHeight]transactions sent
+	sentPerBlock map[uint64]uint64
+}
+
+func NewSpamBudget() *SpamBudget {
+	return &SpamBudget{
+		sentPerBlock: map[uint64]uint64{},
+	}
+}
+
+// take uses one transaction of the block budget, it returns false
+// if the limit is already reached, 0 meaning no limit.
+func (s *SpamBudget) take(height, limit uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if limit > 0 && s.sentPerBlock[height] >= limit {
+		return false
+	}
+
+	// forget about old blocks
+	for h := range s.sentPerBlock {
+		if h < height {
+			delete(s.sentPerBlock, h)
+		}
+	}
+	s.sentPerBlock[height]++
+	return true
+}
+
+func (s *SpamBudget) sent(height uint64) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sentPerBlock[height]
+}
+
+// BatchSender sends the strategy batches to the network while staying
+// within the number of transactions per block and the batch size allowed
+// by the spam protection network parameters.
+//
+// Each batch cancels all the previous orders, so if a batch is still
+// waiting for budget when a new one is submitted, the old one is simply
+// replaced by the new one. One-off batches, like the operator commands,
+// are never replaced and go before the strategy batches.
+type BatchSender struct {
+	w       *wallet.Client
+	pubkey  string
+	vega    *VegaStore
+	nodes   *DataNodePool
+	tracker *TxTracker
+	budget  *SpamBudget
+
+	mu sync.Mutex
+	// reference and parts of the batch waiting to be sent
+	queueRef string
+	queue    []*commandspb.BatchMarketInstructions
+	// one-off batches waiting to be sent, in order
+	oneOff []pendingBatch
+
+	splitBatches uint64
+	coalesced    uint64
+	delayed      uint64
+
+	wake chan struct{}
+}
+
+type pendingBatch struct {
+	ref   string
+	parts []*commandspb.BatchMarketInstructions
+}
+
+func NewBatchSender(
+	w *wallet.Client,
+	pubkey string,
+	vega *VegaStore,
+	nodes *DataNodePool,
+	tracker *TxTracker,
+	budget *SpamBudget,
+) *BatchSender {
+	return &BatchSender{
+		w:       w,
+		pubkey:  pubkey,
+		vega:    vega,
+		nodes:   nodes,
+		tracker: tracker,
+		budget:  budget,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Submit queues a batch to be sent as soon as the budget allows it.
+func (b *BatchSender) Submit(ref string, batch *commandspb.BatchMarketInstructions) {
+	b.mu.Lock()
+	if len(b.queue) > 0 {
+		log.Printf("batch %v still waiting for spam budget, replaced by %v", b.queueRef, ref)
+		b.coalesced++
+	}
+
+	b.queueRef = ref
+	b.queue = splitBatch(batch, b.maxBatchSize())
+	if len(b.queue) > 1 {
+		log.Printf("batch %v split in %v parts to fit the max batch size", ref, len(b.queue))
+		b.splitBatches++
+	}
+	b.mu.Unlock()
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// SubmitOneOff queues a batch which must be sent whatever the strategy
+// submits next, it goes out before any strategy batch.
+func (b *BatchSender) SubmitOneOff(ref string, batch *commandspb.BatchMarketInstructions) {
+	b.mu.Lock()
+	parts := splitBatch(batch, b.maxBatchSize())
+	b.oneOff = append(b.oneOff, pendingBatch{ref: ref, parts: parts})
+	if len(parts) > 1 {
+		log.Printf("batch %v split in %v parts to fit the max batch size", ref, len(parts))
+		b.splitBatches++
+	}
+	b.mu.Unlock()
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Send sends a transaction other than the batches, like the liquidity
+// provision ones, as soon as the budget allows it.
+func (b *BatchSender) Send(req *walletpb.SubmitTransactionRequest) error {
+	for !b.budget.take(b.blockHeight(), b.txPerBlock()) {
+		b.mu.Lock()
+		b.delayed++
+		b.mu.Unlock()
+		time.Sleep(batchSenderInterval)
+	}
+
+	return b.w.SendTransaction(context.Background(), b.pubkey, req)
+}
+
+// Clear drops the strategy batch waiting to be sent, including the
+// parts of a split batch which are not sent yet.
+func (b *BatchSender) Clear() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.queue) <= 0 {
+		return
+	}
+
+	log.Printf("batch %v still waiting for spam budget, dropped", b.queueRef)
+	b.queue = nil
+}
+
+func (b *BatchSender) Run() {
+	ticker := time.NewTicker(batchSenderInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.wake:
+		}
+
+		for {
+			ref, part, ok := b.next()
+			if !ok {
+				break
+			}
+
+			// only the parts actually sent are tracked, the ones
+			// replaced or dropped while waiting never reach the network
+			b.tracker.Track(ref, newOrderIntents(ref, part.Submissions))
+			err := b.w.SendTransaction(
+				context.Background(), b.pubkey, &walletpb.SubmitTransactionRequest{
+					Command: &walletpb.SubmitTransactionRequest_BatchMarketInstructions{
+						BatchMarketInstructions: part,
+					},
+				},
+			)
+			if err != nil {
+				log.Printf("error submitting batch: %v", err)
+				b.tracker.Failed(ref, err)
+				b.drop(ref)
+				break
+			}
+
+			log.Printf("batch submission: %v", part.String())
+		}
+	}
+}
+
+// next pops the next part to send if the budget allows it.
+func (b *BatchSender) next() (string, *commandspb.BatchMarketInstructions, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.queue) <= 0 && len(b.oneOff) <= 0 {
+		return "", nil, false
+	}
+
+	if !b.budget.take(b.blockHeight(), b.txPerBlock()) {
+		b.delayed++
+		return "", nil, false
+	}
+
+	if len(b.oneOff) > 0 {
+		next := &b.oneOff[0]
+		part := next.parts[0]
+		next.parts = next.parts[1:]
+		ref := next.ref
+		if len(next.parts) <= 0 {
+			b.oneOff = b.oneOff[1:]
+		}
+		return ref, part, true
+	}
+
+	part := b.queue[0]
+	b.queue = b.queue[1:]
+	return b.queueRef, part, true
+}
+
+func (b *BatchSender) drop(ref string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.queueRef == ref {
+		b.queue = nil
+	}
+	if len(b.oneOff) > 0 && b.oneOff[0].ref == ref {
+		b.oneOff = b.oneOff[1:]
+	}
+}
+
+func (b *BatchSender) Stats() SpamStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	height := b.blockHeight()
+	queued := len(b.queue)
+	for _, p := range b.oneOff {
+		queued += len(p.parts)
+	}
+	return SpamStats{
+		BlockHeight:   height,
+		TxPerBlock:    b.txPerBlock(),
+		MaxBatchSize:  b.maxBatchSize(),
+		SentThisBlock: b.budget.sent(height),
+		QueuedParts:   queued,
+		SplitBatches:  b.splitBatches,
+		Coalesced:     b.coalesced,
+		Delayed:       b.delayed,
+	}
+}
+
+// blockHeight returns the current block height, shared by all the senders
+// of the process so they count in the same block. If the data node doesn't
+// report it we assume one block per second.
+func (b *BatchSender) blockHeight() uint64 {
+	if height := b.nodes.BlockHeight(); height > 0 {
+		return height
+	}
+	return uint64(time.Now().Unix())
+}
+
+func (b *BatchSender) txPerBlock() uint64 {
+	return getUintNetworkParameter(b.vega, netParamSpamPoWNumberOfTxPerBlock)
+}
+
+func (b *BatchSender) maxBatchSize() uint64 {
+	return getUintNetworkParameter(b.vega, netParamSpamMaxBatchSize)
+}
+
+// getUintNetworkParameter returns 0 if the parameter
+// is not available, meaning no limit.
+func getUintNetworkParameter(vega *VegaStore, key string) uint64 {
+	value, ok := vega.GetNetworkParameter(key)
+	if !ok {
+		return 0
+	}
+
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		log.Printf("invalid network parameter %v: %v", key, value)
+		return 0
+	}
+	return n
+}
+
+// splitBatch splits a batch so none of the parts contains more
+// instructions than the max batch size. The cancellations always go
+// first so the new orders are never placed on top of the old ones.
+func splitBatch(
+	batch *commandspb.BatchMarketInstructions,
+	maxSize uint64,
+) []*commandspb.BatchMarketInstructions {
+	size := uint64(len(batch.Cancellations) + len(batch.Amendments) + len(batch.Submissions))
+	if maxSize <= 0 || size <= maxSize {
+		return []*commandspb.BatchMarketInstructions{batch}
+	}
+
+	parts := []*commandspb.BatchMarketInstructions{}
+	current := &commandspb.BatchMarketInstructions{}
+	add := func() *commandspb.BatchMarketInstructions {
+		n := uint64(len(current.Cancellations) + len(current.Amendments) + len(current.Submissions))
+		if n >= maxSize {
+			parts = append(parts, current)
+			current = &commandspb.BatchMarketInstructions{}
+		}
+		return current
+	}
+
+	for _, c := range batch.Cancellations {
+		p := add()
+		p.Cancellations = append(p.Cancellations, c)
+	}
+	for _, a := range batch.Amendments {
+		p := add()
+		p.Amendments = append(p.Amendments, a)
+	}
+	for _, s := range batch.Submissions {
+		p := add()
+		p.Submissions = append(p.Submissions, s)
+	}
+
+	return append(parts, current)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	commandspb "code.vegaprotocol.io/vega/protos/vega/commands/v1"
+)
+
+func testBatch(cancellations, amendments, submissions int) *commandspb.BatchMarketInstructions {
+	batch := &commandspb.BatchMarketInstructions{}
+	for i := 0; i < cancellations; i++ {
+		batch.Cancellations = append(batch.Cancellations, &commandspb.OrderCancellation{})
+	}
+	for i := 0; i < amendments; i++ {
+		batch.Amendments = append(batch.Amendments, &commandspb.OrderAmendment{})
+	}
+	for i := 0; i < submissions; i++ {
+		batch.Submissions = append(batch.Submissions, &commandspb.OrderSubmission{})
+	}
+	return batch
+}
+
+func TestSplitBatch(t *testing.T) {
+	cases := []struct {
+		name    string
+		batch   *commandspb.BatchMarketInstructions
+		maxSize uint64
+		// cancellations, amendments and submissions of each part
+		expected [][3]int
+	}{
+		{"no limit", testBatch(1, 2, 10), 0, [][3]int{{1, 2, 10}}},
+		{"fits in one", testBatch(1, 0, 4), 5, [][3]int{{1, 0, 4}}},
+		{"exactly the limit", testBatch(1, 1, 3), 5, [][3]int{{1, 1, 3}}},
+		{"cancellations go first", testBatch(1, 0, 6), 3, [][3]int{{1, 0, 2}, {0, 0, 3}, {0, 0, 1}}},
+		{"amendments before submissions", testBatch(0, 3, 2), 2, [][3]int{{0, 2, 0}, {0, 1, 1}, {0, 0, 1}}},
+		{"one per part", testBatch(1, 1, 1), 1, [][3]int{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			parts := splitBatch(c.batch, c.maxSize)
+			if len(parts) != len(c.expected) {
+				t.Fatalf("expected %v parts, got %v", len(c.expected), len(parts))
+			}
+			for i, p := range parts {
+				got := [3]int{len(p.Cancellations), len(p.Amendments), len(p.Submissions)}
+				if got != c.expected[i] {
+					t.Errorf("part %v: expected %v, got %v", i, c.expected[i], got)
+				}
+			}
+		})
+	}
+}
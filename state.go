@@ -0,0 +1,75 @@
+package main
+
+import (
+	"sync"
+
+	"golang.org/x/exp/slices"
+)
+
+// StrategyStore keeps the information produced by the strategy
+// which are useful to expose through the state API.
+type StrategyStore struct {
+	mu sync.RWMutex
+
+	// quote levels affected by the price monitoring bounds
+	// during the last strategy execution
+	clampedLevels []ClampedLevel
+	// our liquidity commitment status as of
+	// the last strategy execution
+	slaStatus SLAStatus
+	// funding of the perpetual market as of
+	// the last strategy execution
+	fundingStatus FundingStatus
+	// operator commands
+	control ControlStatus
+	// strategy parameters in use, the pending ones
+	// are applied on the next strategy execution
+	params        StrategyParams
+	pendingParams *StrategyParams
+	paramChanges  []ParamChange
+
+	wake chan struct{}
+}
+
+func NewStrategyStore(params StrategyParams) *StrategyStore {
+	return &StrategyStore{
+		params: params,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+func (s *StrategyStore) SetClampedLevels(levels []ClampedLevel) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clampedLevels = levels
+}
+
+func (s *StrategyStore) GetClampedLevels() []ClampedLevel {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.clampedLevels)
+}
+
+func (s *StrategyStore) SetSLAStatus(status SLAStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.slaStatus = status
+}
+
+func (s *StrategyStore) GetSLAStatus() SLAStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.slaStatus
+}
+
+func (s *StrategyStore) SetFundingStatus(status FundingStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fundingStatus = status
+}
+
+func (s *StrategyStore) GetFundingStatus() FundingStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.fundingStatus
+}
@@ -1,189 +1,394 @@
 package main
 
 import (
-	"context"
 	"log"
 	"time"
 
 	vegapb "code.vegaprotocol.io/vega/protos/vega"
 	commandspb "code.vegaprotocol.io/vega/protos/vega/commands/v1"
 	walletpb "code.vegaprotocol.io/vega/protos/vega/wallet/v1"
-	"github.com/jeremyletang/vega-go-sdk/wallet"
 	"github.com/shopspring/decimal"
 )
 
 func RunStrategy(
 	config *Config,
-	w *wallet.Client,
+	nodes *DataNodePool,
 	vega *VegaStore,
 	refPrice *BinanceRP,
+	state *StrategyStore,
+	tracker *TxTracker,
+	sender *BatchSender,
 ) {
 	var (
 		pubkey = config.WalletPubkey
 		mktid  = config.VegaMarket
-		lpFee  = decimal.RequireFromString(config.LPFee)
+		// tick size, in market precision
+		tickSize = decimal.RequireFromString(config.TickSize)
+		// how much the funding rate moves our prices, and up to where
+		fundingSkewFactor = decimal.RequireFromString(config.FundingSkewFactor)
+		fundingMaxSkew    = decimal.RequireFromString(config.FundingMaxSkew)
+		// sequence number of the batches we send,
+		// used to build unique order references
+		batchSeq uint64
+		// set while the vega data lags behind, our
+		// orders are pulled once when it starts
+		lagging bool
+		// same while we back off after rejections
+		backingOff bool
+		// same while the streams resync
+		stale bool
+		// same when the operator pauses the quoting
+		wasPaused bool
 	)
 
+	// cancel all our orders, and whatever batch is still
+	// waiting to be sent so it doesn't place them again
+	clearOrders := func() {
+		batchSeq++
+		clearAllOrders(sender, mktid, newBatchReference(config.BotID, batchSeq))
+	}
+
 	// first we cleanup the current state
 	// we cancel all existing orders
-	clearAllOrders(w, pubkey, mktid)
+	clearOrders()
 
-	assetBalance := getAssetBalance(vega, pubkey, mktid)
+	ticker := time.NewTicker(5 * time.Second)
+	for {
+		select {
+		case <-ticker.C:
+		case <-state.Wake():
+		}
 
-	// our commitment amount will be 1/10 of the balance
-	commitmentAmount := assetBalance.Div(decimal.NewFromInt(9))
+		log.Printf("executing trading strategy...")
 
-	// then get / create a new liquidity provision
-	err := getOrCreateLPSubmission(w, vega, pubkey, mktid, commitmentAmount, lpFee)
-	if err != nil {
-		log.Fatalf("couldn't get or submit liquidity order: %v", err)
-	}
+		// new parameters only apply from the start of an execution,
+		// including the ones when paused so the API reports them applied
+		params := state.takeParams()
+
+		// operator commands go first, whatever the state of the data
+		paused, cancelAll, flatten := state.takeCommands()
+		if flatten {
+			batchSeq++
+			batchRef := newBatchReference(config.BotID, batchSeq)
+			if order := getFlattenOrder(vega.GetMarket(), vega.GetPosition(), batchRef); order != nil {
+				log.Printf("flattening position with %v", order.String())
+				batch := commandspb.BatchMarketInstructions{
+					Cancellations: []*commandspb.OrderCancellation{{MarketId: mktid}},
+					Submissions:   []*commandspb.OrderSubmission{order},
+				}
+				// sent as a one-off so the next quotes cannot replace
+				// it while it waits for spam budget
+				sender.Clear()
+				sender.SubmitOneOff(batchRef, &batch)
+				// quote again once the position is closed
+				continue
+			}
+			log.Printf("no position to flatten")
+		}
+		if cancelAll || (paused && !wasPaused) {
+			log.Printf("cancelling all orders on operator request")
+			clearOrders()
+		}
+		wasPaused = paused
+		if paused {
+			log.Printf("quoting paused by the operator")
+			continue
+		}
+		if cancelAll {
+			// quoting now would place the orders straight back
+			log.Printf("orders cancelled by the operator, quoting again on the next execution")
+			continue
+		}
 
-	for range time.NewTicker(5 * time.Second).C {
-		log.Printf("executing trading strategy...")
-		if mkt := vega.GetMarket(); mkt != nil {
-			var assetId string
-			if future := mkt.GetTradableInstrument().
-				GetInstrument().
-				GetFuture(); future != nil {
-				assetId = future.GetSettlementAsset()
-			} else if perps := mkt.GetTradableInstrument().
-				GetInstrument().
-				GetPerpetual(); perps != nil {
-				assetId = perps.GetSettlementAsset()
+		tracker.Expire()
+		if backoff := tracker.Backoff(); backoff > 0 {
+			log.Printf("too many rejected transactions, backing off for %v", backoff)
+			if !backingOff {
+				clearOrders()
+				backingOff = true
 			}
+			continue
+		}
+		backingOff = false
 
-			printCurrentSLAStats(vega, pubkey)
+		if streams := vega.GetStale(); len(streams) > 0 {
+			log.Printf("vega data is stale, waiting for streams to resync: %v", streams)
+			if !stale {
+				clearOrders()
+				stale = true
+			}
+			continue
+		}
+		stale = false
 
-			asset := vega.GetAsset(assetId)
+		if lag := vega.GetDataLag(time.Now(), nodes.VegaTime()); lag > config.MaxDataLag {
+			log.Printf("ALERT: vega data is %v behind, not quoting until it catches up", lag.Truncate(time.Second))
+			if !lagging {
+				clearOrders()
+				lagging = true
+			}
+			continue
+		}
+		lagging = false
+
+		if mkt := vega.GetMarket(); mkt != nil {
+			asset := vega.GetAsset(getSettlementAsset(mkt))
+			if asset == nil {
+				log.Printf("settlement asset of the market not found, not quoting")
+				continue
+			}
 
-			d := newDecimals(mkt, asset)
+			d := newDecimals(mkt, asset, tickSize)
 
 			log.Printf("updating quotes for %v", mkt.GetTradableInstrument().GetInstrument().GetName())
 			bestBid, bestAsk := refPrice.Get()
 			log.Printf("new reference prices: bestBid(%v), bestAsk(%v)", bestBid, bestAsk)
-			openVol, aep := volumeAndAverageEntryPrice(d, mkt, vega.GetPosition())
+
+			// lean towards the side receiving funding on perpetuals
+			if funding, ok := getFundingStatus(
+				d, mkt, vega.GetMarketData(), vega.GetPosition(),
+				vega.GetFundingPeriods(), fundingSkewFactor, fundingMaxSkew,
+			); ok {
+				bestBid, bestAsk = applyFundingSkew(funding, bestBid, bestAsk)
+				state.SetFundingStatus(funding)
+			}
 			balance := getPubkeyBalance(vega, pubkey, asset.Id, int64(asset.Details.Decimals))
 			log.Printf("pubkey balance: %v", balance)
-			bidVol := balance.Mul(decimal.NewFromFloat(0.9)).Sub(openVol.Mul(aep))
-			offerVol := balance.Mul(decimal.NewFromFloat(0.9)).Add(openVol.Mul(aep))
-			notionalExposure := openVol.Mul(aep).Abs()
-			log.Printf("openvolume(%v), entryPrice(%v), notionalExposure(%v)",
-				openVol, aep, notionalExposure,
+
+			var (
+				bidVol, offerVol decimal.Decimal
+				// on spot markets, what we can spend on bids and sell
+				spot                     bool
+				quoteBudget, baseBalance decimal.Decimal
 			)
+			if base := getBaseAsset(mkt); len(base) > 0 {
+				// spot, we can only buy with the quote asset
+				// we own and sell the base asset we own
+				baseAsset := vega.GetAsset(base)
+				if baseAsset == nil {
+					log.Printf("base asset of the market not found, not quoting")
+					continue
+				}
+				spot = true
+				baseBalance = getPubkeyBalance(vega, pubkey, baseAsset.Id, int64(baseAsset.Details.Decimals))
+				log.Printf("pubkey base balance: %v", baseBalance)
+				// the bond of our liquidity provision is paid in the quote asset
+				quoteBudget = balance.Sub(getReservedBond(vega, pubkey, mktid, asset))
+				if quoteBudget.IsNegative() {
+					quoteBudget = decimal.Zero
+				}
+				bidVol = quoteBudget.Mul(params.BalanceFraction)
+				offerVol = baseBalance.Mul(params.BalanceFraction).Mul(bestAsk)
+			} else {
+				openVol, aep := volumeAndAverageEntryPrice(d, mkt, vega.GetPosition())
+				bidVol = balance.Mul(params.BalanceFraction).Sub(openVol.Mul(aep))
+				offerVol = balance.Mul(params.BalanceFraction).Add(openVol.Mul(aep))
+				notionalExposure := openVol.Mul(aep).Abs()
+				log.Printf("openvolume(%v), entryPrice(%v), notionalExposure(%v)",
+					openVol, aep, notionalExposure,
+				)
+			}
 			log.Printf("bidVolume(%v), offerVolume(%v)", bidVol, offerVol)
 
+			batchSeq++
+			batchRef := newBatchReference(config.BotID, batchSeq)
+
+			bounds := getPriceBounds(vega.GetMarketData())
+			bids, clampedBids := getOrderSubmission(d, params, bestBid, vegapb.Side_SIDE_BUY, mktid, bidVol, bounds, batchRef)
+			asks, clampedAsks := getOrderSubmission(d, params, bestAsk, vegapb.Side_SIDE_SELL, mktid, offerVol, bounds, batchRef)
+			clamped := append(clampedBids, clampedAsks...)
+			logClampedLevels(clamped)
+			state.SetClampedLevels(clamped)
+
+			// make sure enough volume sits in the liquidity range to meet our commitment
+			if config.Strategy == strategyLiquidity {
+				sla := getCurrentSLAStats(vega, pubkey)
+				lpRange := getLiquidityRange(d, mkt, vega.GetMarketData(), bestBid.Add(bestAsk).Div(decimal.NewFromInt(2)))
+				required := getRequiredLiquidity(vega, sla, asset.Details.Decimals)
+				var bidsInRange, asksInRange decimal.Decimal
+				bids, bidsInRange = ensureSLAVolume(d, bids, vegapb.Side_SIDE_BUY, lpRange, bounds, required, bidVol)
+				asks, asksInRange = ensureSLAVolume(d, asks, vegapb.Side_SIDE_SELL, lpRange, bounds, required, offerVol)
+				if spot {
+					// whatever the commitment requires, we can't quote more than we own
+					bids = capSpotOrders(d, bids, vegapb.Side_SIDE_BUY, quoteBudget)
+					asks = capSpotOrders(d, asks, vegapb.Side_SIDE_SELL, baseBalance)
+					bidsInRange, asksInRange = volumeInRange(d, bids, lpRange), volumeInRange(d, asks, lpRange)
+				}
+				state.SetSLAStatus(getSLAStatus(mkt, sla, lpRange, required, bidsInRange, asksInRange))
+			}
+
+			logBookPosition(vega.GetMarketDepth(1), bids, asks)
+
 			batch := commandspb.BatchMarketInstructions{
 				Cancellations: []*commandspb.OrderCancellation{
 					{
 						MarketId: mktid,
 					},
 				},
-				Submissions: append(
-					getOrderSubmission(d, bestBid, vegapb.Side_SIDE_BUY, mktid, bidVol),
-					getOrderSubmission(d, bestAsk, vegapb.Side_SIDE_SELL, mktid, offerVol)...,
-				),
+				Submissions: append(bids, asks...),
 			}
 
-			err := w.SendTransaction(
-				context.Background(), pubkey, &walletpb.SubmitTransactionRequest{
-					Command: &walletpb.SubmitTransactionRequest_BatchMarketInstructions{
-						BatchMarketInstructions: &batch,
-					},
-				},
-			)
-			if err != nil {
-				log.Printf("error submitting batch: %v", err)
-			}
-
-			log.Printf("batch submission: %v", batch.String())
+			sender.Submit(batchRef, &batch)
 		}
 	}
 }
 
-func printCurrentSLAStats(
-	vega *VegaStore,
-	pubkey string,
-) {
-	for _, v := range vega.GetMarketData().LiquidityProviderSla {
-		if v.Party == pubkey {
-			log.Printf("current SLA stats: %v", v.String())
-			return
-		}
+// getSettlementAsset returns the asset the market is priced and pays
+// fees in, which for spot markets is the quote asset.
+func getSettlementAsset(mkt *vegapb.Market) string {
+	if future := mkt.GetTradableInstrument().
+		GetInstrument().
+		GetFuture(); future != nil {
+		return future.GetSettlementAsset()
+	} else if perps := mkt.GetTradableInstrument().
+		GetInstrument().
+		GetPerpetual(); perps != nil {
+		return perps.GetSettlementAsset()
+	} else if spot := mkt.GetTradableInstrument().
+		GetInstrument().
+		GetSpot(); spot != nil {
+		return spot.GetQuoteAsset()
 	}
 
-	log.Printf("no SLA stats available yet...")
+	return ""
+}
+
+// getBaseAsset returns the asset being traded on a spot
+// market, and an empty string for the other markets.
+func getBaseAsset(mkt *vegapb.Market) string {
+	return mkt.GetTradableInstrument().GetInstrument().GetSpot().GetBaseAsset()
 }
 
+// getAssetBalance returns the balance of the settlement asset
+// of the market, in asset precision.
 func getAssetBalance(
 	vega *VegaStore,
 	pubkey, market string,
 ) decimal.Decimal {
 	var assetBalance decimal.Decimal
-	var assetSym string
 	if mkt := vega.GetMarket(); mkt != nil {
-		var assetId string
-		if future := mkt.GetTradableInstrument().
-			GetInstrument().
-			GetFuture(); future != nil {
-			assetId = future.GetSettlementAsset()
-		} else if perps := mkt.GetTradableInstrument().
-			GetInstrument().
-			GetPerpetual(); perps != nil {
-			assetId = perps.GetSettlementAsset()
+		asset := vega.GetAsset(getSettlementAsset(mkt))
+		if asset == nil {
+			return assetBalance
 		}
 
-		asset := vega.GetAsset(assetId)
-
-		assetSym = asset.Details.Symbol
-
-		log.Printf("market is using asset %v", asset.Details.Symbol)
-
 		accounts := vega.GetAccounts()
 		// get all balances for the party which
 		// are either general + asset ID or
 		// market ID.
 		for _, acc := range accounts {
-			if acc.Asset == asset.Id && acc.Type == vegapb.AccountType_ACCOUNT_TYPE_GENERAL {
+			// on spot markets the funds of our orders are on hold
+			if acc.Asset == asset.Id && (acc.Type == vegapb.AccountType_ACCOUNT_TYPE_GENERAL ||
+				acc.Type == vegapb.AccountType_ACCOUNT_TYPE_HOLDING) {
 				if len(acc.Balance) > 0 {
 					assetBalance = assetBalance.Add(decimal.RequireFromString(acc.Balance))
 				}
-			} else if acc.MarketId == market {
+			} else if acc.MarketId == market && acc.Asset == asset.Id {
 				if len(acc.Balance) > 0 {
 					assetBalance = assetBalance.Add(decimal.RequireFromString(acc.Balance))
 				}
 			}
 		}
+	}
 
+	return assetBalance
+}
+
+// getReservedBond returns, in asset units, the part of our balance
+// committed to the liquidity of the market, including a pending
+// commitment not moved to the bond account yet.
+func getReservedBond(
+	vega *VegaStore,
+	pubkey, market string,
+	asset *vegapb.Asset,
+) decimal.Decimal {
+	var reserved decimal.Decimal
+	if acc := vega.GetAccount(market, asset.Id, vegapb.AccountType_ACCOUNT_TYPE_BOND); acc != nil {
+		reserved, _ = decimal.NewFromString(acc.Balance)
 	}
+	for _, lp := range []*vegapb.LiquidityProvision{
+		vega.GetLiquidityProvison(),
+		vega.GetPendingLiquidityProvision(),
+	} {
+		if lp == nil {
+			continue
+		}
+		if c, err := decimal.NewFromString(lp.CommitmentAmount); err == nil && c.GreaterThan(reserved) {
+			reserved = c
+		}
+	}
+
+	return reserved.Div(decimal.NewFromInt(10).Pow(decimal.NewFromInt(int64(asset.Details.Decimals))))
+}
 
-	if assetBalance.IsZero() {
-		log.Fatalf("no balance for asset %v, please deposit funds first", assetSym)
+// capSpotOrders reduces the orders, worst level first, so they don't need
+// more than we hold on a spot market: the quote asset for the bids, and the
+// base asset for the offers, in asset units.
+func capSpotOrders(
+	d decimals,
+	orders []*commandspb.OrderSubmission,
+	side vegapb.Side,
+	holding decimal.Decimal,
+) []*commandspb.OrderSubmission {
+	// what one unit of size of the order needs
+	unit := func(o *commandspb.OrderSubmission) decimal.Decimal {
+		size := d.FromMarketPositionPrecision(decimal.NewFromInt(1))
+		if side == vegapb.Side_SIDE_SELL {
+			return size
+		}
+		price, _ := decimal.NewFromString(o.Price)
+		return size.Mul(d.FromMarketPricePrecision(price))
 	}
 
-	return assetBalance
+	var total decimal.Decimal
+	for _, o := range orders {
+		total = total.Add(unit(o).Mul(decimal.NewFromInt(int64(o.Size))))
+	}
+
+	for i := len(orders) - 1; i >= 0 && total.GreaterThan(holding); i-- {
+		o, u := orders[i], unit(orders[i])
+		if !u.IsPositive() {
+			continue
+		}
+
+		cut := total.Sub(holding).Div(u).Ceil().BigInt().Uint64()
+		if cut > o.Size {
+			cut = o.Size
+		}
+		log.Printf("reducing %v order %v by %v to fit our holdings of %v", side.String(), o.Reference, cut, holding)
+		o.Size -= cut
+		total = total.Sub(u.Mul(decimal.NewFromInt(int64(cut))))
+	}
+
+	out := []*commandspb.OrderSubmission{}
+	for _, o := range orders {
+		if o.Size > 0 {
+			out = append(out, o)
+		}
+	}
+	return out
 }
 
 func getOrCreateLPSubmission(
-	w *wallet.Client,
+	sender *BatchSender,
 	vega *VegaStore,
-	pubkey, market string,
+	market string,
 	commitmentAmount decimal.Decimal,
 	lpFee decimal.Decimal,
 ) error {
 	lp := vega.GetLiquidityProvison()
 	switch lp {
 	case nil:
-		return submitNewLP(w, vega, pubkey, market, commitmentAmount, lpFee)
+		return submitNewLP(sender, vega, market, commitmentAmount, lpFee)
 	default:
-		return maybeAmendLP(w, vega, pubkey, market, commitmentAmount, lp, lpFee)
+		return maybeAmendLP(sender, vega, market, commitmentAmount, lp, lpFee)
 	}
 }
 
 func submitNewLP(
-	w *wallet.Client,
+	sender *BatchSender,
 	vega *VegaStore,
-	pubkey, market string,
+	market string,
 	commitmentAmount decimal.Decimal,
 	lpFee decimal.Decimal,
 ) error {
@@ -195,13 +400,11 @@ func submitNewLP(
 		Fee:              lpFee.String(),
 	}
 
-	err := w.SendTransaction(
-		context.Background(), pubkey, &walletpb.SubmitTransactionRequest{
-			Command: &walletpb.SubmitTransactionRequest_LiquidityProvisionSubmission{
-				LiquidityProvisionSubmission: lp,
-			},
+	err := sender.Send(&walletpb.SubmitTransactionRequest{
+		Command: &walletpb.SubmitTransactionRequest_LiquidityProvisionSubmission{
+			LiquidityProvisionSubmission: lp,
 		},
-	)
+	})
 	if err != nil {
 		log.Printf("error submitting liquidity submission: %v", err)
 		return err
@@ -213,9 +416,9 @@ func submitNewLP(
 }
 
 func maybeAmendLP(
-	w *wallet.Client,
+	sender *BatchSender,
 	vega *VegaStore,
-	pubkey, market string,
+	market string,
 	commitmentAmount decimal.Decimal,
 	existingLP *vegapb.LiquidityProvision,
 	lpFee decimal.Decimal,
@@ -252,13 +455,11 @@ func maybeAmendLP(
 		Fee:              lpFee.String(),
 	}
 
-	err := w.SendTransaction(
-		context.Background(), pubkey, &walletpb.SubmitTransactionRequest{
-			Command: &walletpb.SubmitTransactionRequest_LiquidityProvisionAmendment{
-				LiquidityProvisionAmendment: lpAmend,
-			},
+	err := sender.Send(&walletpb.SubmitTransactionRequest{
+		Command: &walletpb.SubmitTransactionRequest_LiquidityProvisionAmendment{
+			LiquidityProvisionAmendment: lpAmend,
 		},
-	)
+	})
 	if err != nil {
 		log.Printf("error submitting liquidity submission: %v", err)
 		return err
@@ -269,44 +470,44 @@ func maybeAmendLP(
 	return nil
 }
 
-func clearAllOrders(
-	w *wallet.Client,
-	pubkey, market string,
-) {
-	batch := commandspb.BatchMarketInstructions{
+// clearAllOrders drops the batch waiting to be sent, if any,
+// and cancels all our orders on the market.
+func clearAllOrders(sender *BatchSender, market, batchRef string) {
+	sender.Clear()
+	sender.Submit(batchRef, &commandspb.BatchMarketInstructions{
 		Cancellations: []*commandspb.OrderCancellation{
 			{
 				MarketId: market,
 			},
 		},
-	}
-
-	err := w.SendTransaction(
-		context.Background(), pubkey, &walletpb.SubmitTransactionRequest{
-			Command: &walletpb.SubmitTransactionRequest_BatchMarketInstructions{
-				BatchMarketInstructions: &batch,
-			},
-		},
-	)
-	if err != nil {
-		log.Printf("error submitting batch: %v", err)
-	}
+	})
 }
 
 func getOrderSubmission(
 	d decimals,
+	params StrategyParams,
 	refPrice decimal.Decimal,
 	side vegapb.Side,
 	mktid string,
 	targetVolume decimal.Decimal,
-) []*commandspb.OrderSubmission {
-	size := targetVolume.Div(decimal.NewFromInt(5).Mul(refPrice))
+	bounds priceBounds,
+	batchRef string,
+) ([]*commandspb.OrderSubmission, []ClampedLevel) {
+	size := d.ToMarketPositionIncrement(targetVolume.Div(decimal.NewFromInt(int64(params.Levels)).Mul(refPrice)))
 	orders := []*commandspb.OrderSubmission{}
+	clamped := []ClampedLevel{}
+
+	if !size.IsPositive() {
+		log.Printf("%v size rounds to zero, no orders placed", side.String())
+		return orders, clamped
+	}
+
+	bounds = bounds.AlignToTick(d)
 
 	priceF := func(i int) decimal.Decimal {
 		return refPrice.Mul(
 			decimal.NewFromInt(1).Sub(
-				decimal.NewFromInt(int64(i)).Mul(decimal.NewFromFloat(0.002)),
+				decimal.NewFromInt(int64(i)).Mul(params.LevelSpacing),
 			),
 		)
 	}
@@ -314,25 +515,50 @@ func getOrderSubmission(
 		priceF = func(i int) decimal.Decimal {
 			return refPrice.Mul(
 				decimal.NewFromInt(1).Add(
-					decimal.NewFromInt(int64(i)).Mul(decimal.NewFromFloat(0.002)),
+					decimal.NewFromInt(int64(i)).Mul(params.LevelSpacing),
 				),
 			)
 		}
 	}
 
-	for i := 1; i <= 5; i++ {
+	// prices already used on this side, levels clamped
+	// on the same bound collapse into a single one
+	prices := map[string]struct{}{}
+	for i := 1; i <= params.Levels; i++ {
+		price := d.ToMarketTickPrice(priceF(i), side)
+		if !price.IsPositive() {
+			continue
+		}
+		clampedPrice, drop := bounds.Clamp(side, price)
+		if _, ok := prices[clampedPrice.String()]; ok {
+			drop = true
+		}
+		if drop || !clampedPrice.Equal(price) {
+			clamped = append(clamped, ClampedLevel{
+				Side:         side.String(),
+				Level:        i,
+				Price:        price.String(),
+				ClampedPrice: clampedPrice.String(),
+				Dropped:      drop,
+			})
+		}
+		if drop {
+			continue
+		}
+		prices[clampedPrice.String()] = struct{}{}
+
 		orders = append(orders, &commandspb.OrderSubmission{
 			MarketId:    mktid,
-			Price:       d.ToMarketPricePrecision(priceF(i)).BigInt().String(),
-			Size:        d.ToMarketPositionPrecision(size).BigInt().Uint64(),
+			Price:       clampedPrice.String(),
+			Size:        size.BigInt().Uint64(),
 			Side:        side,
 			TimeInForce: vegapb.Order_TIME_IN_FORCE_GTC,
 			Type:        vegapb.Order_TYPE_LIMIT,
-			Reference:   "VEGA_GO_MM_SIMPLE",
+			Reference:   newOrderReference(batchRef, side, i),
 		})
 	}
 
-	return orders
+	return orders, clamped
 }
 
 func getPubkeyBalance(
@@ -364,31 +590,3 @@ func volumeAndAverageEntryPrice(
 
 	return d.FromMarketPositionPrecision(vol), d.FromMarketPricePrecision(aep)
 }
-
-type decimals struct {
-	positionFactor decimal.Decimal
-	priceFactor    decimal.Decimal
-}
-
-func newDecimals(mkt *vegapb.Market, asset *vegapb.Asset) decimals {
-	return decimals{
-		positionFactor: decimal.NewFromFloat(10).Pow(decimal.NewFromInt(mkt.PositionDecimalPlaces)),
-		priceFactor:    decimal.NewFromFloat(10).Pow(decimal.NewFromInt(int64(mkt.DecimalPlaces))),
-	}
-}
-
-func (d decimals) FromMarketPricePrecision(price decimal.Decimal) decimal.Decimal {
-	return price.Div(d.priceFactor)
-}
-
-func (d decimals) FromMarketPositionPrecision(pos decimal.Decimal) decimal.Decimal {
-	return pos.Div(d.positionFactor)
-}
-
-func (d decimals) ToMarketPricePrecision(price decimal.Decimal) decimal.Decimal {
-	return price.Mul(d.priceFactor)
-}
-
-func (d decimals) ToMarketPositionPrecision(pos decimal.Decimal) decimal.Decimal {
-	return pos.Mul(d.positionFactor)
-}
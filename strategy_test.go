@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	commandspb "code.vegaprotocol.io/vega/protos/vega/commands/v1"
+	"github.com/shopspring/decimal"
+)
+
+func TestCapSpotOrders(t *testing.T) {
+	cases := []struct {
+		name     string
+		d        decimals
+		orders   []*commandspb.OrderSubmission
+		side     vegapb.Side
+		holding  string
+		expected []testOrder
+	}{
+		{
+			"bids within the quote balance",
+			testDecimals(0, 0, "1"), testOrders(testOrder{"100", 2}, testOrder{"90", 2}),
+			vegapb.Side_SIDE_BUY, "1000", []testOrder{{"100", 2}, {"90", 2}},
+		},
+		{
+			"worst bid reduced",
+			testDecimals(0, 0, "1"), testOrders(testOrder{"100", 2}, testOrder{"90", 2}),
+			vegapb.Side_SIDE_BUY, "300", []testOrder{{"100", 2}, {"90", 1}},
+		},
+		{
+			"worst bid dropped and best bid reduced",
+			testDecimals(0, 0, "1"), testOrders(testOrder{"100", 2}, testOrder{"90", 2}),
+			vegapb.Side_SIDE_BUY, "150", []testOrder{{"100", 1}},
+		},
+		{
+			"nothing held",
+			testDecimals(0, 0, "1"), testOrders(testOrder{"100", 2}, testOrder{"90", 2}),
+			vegapb.Side_SIDE_BUY, "0", []testOrder{},
+		},
+		{
+			"offers capped at the base balance",
+			testDecimals(0, 0, "1"), testOrders(testOrder{"110", 3}, testOrder{"120", 2}),
+			vegapb.Side_SIDE_SELL, "4", []testOrder{{"110", 3}, {"120", 1}},
+		},
+		{
+			"offers in position precision",
+			testDecimals(0, 1, "1"), testOrders(testOrder{"110", 30}),
+			vegapb.Side_SIDE_SELL, "2", []testOrder{{"110", 20}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			orders := capSpotOrders(c.d, c.orders, c.side, decimal.RequireFromString(c.holding))
+			if len(orders) != len(c.expected) {
+				t.Fatalf("expected %v orders, got %v", len(c.expected), len(orders))
+			}
+			for i, o := range orders {
+				if o.Price != c.expected[i].price || o.Size != c.expected[i].size {
+					t.Errorf("order %v: expected %v, got %v@%v", i, c.expected[i], o.Size, o.Price)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	minStreamBackoff = time.Second
+	maxStreamBackoff = time.Minute
+)
+
+// supervise keeps a data node stream running. As soon as the stream fails the
+// store is flagged as stale, then the stream is restarted with a backoff. Once
+// the new stream is open, the store is resynced using the load function and
+// stops being stale.
+func (v *vegaAPI) supervise(
+	name string,
+	stream func(resync func() error) error,
+	load func() error,
+) {
+	var (
+		backoff = minStreamBackoff
+		// the store was populated at startup, no need to resync
+		// when the stream is opened the first time
+		first = true
+	)
+
+	resync := func() error {
+		if first {
+			first = false
+			return nil
+		}
+
+		if err := load(); err != nil {
+			return err
+		}
+
+		log.Printf("%v stream reconnected and resynced", name)
+		v.store.SetStale(name, false)
+		backoff = minStreamBackoff
+		return nil
+	}
+
+	for {
+		err := stream(resync)
+		v.store.SetStale(name, true)
+		first = false
+		log.Printf("%v stream failed, reconnecting in %v: %v", name, backoff, err)
+
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxStreamBackoff {
+			backoff = maxStreamBackoff
+		}
+	}
+}
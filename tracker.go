@@ -0,0 +1,354 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	// how long we wait to see the orders of a transaction
+	// before considering it was never accepted by the network
+	txConfirmationTimeout = 30 * time.Second
+	// how many rejections are kept for inspection
+	maxRecentRejections = 50
+	// how many batches we keep the order intents for
+	maxTrackedBatches = 100
+	// bounds of the backoff applied once we reach the rejection threshold
+	minRejectionBackoff = 5 * time.Second
+	maxRejectionBackoff = 5 * time.Minute
+)
+
+// Rejection is an order or transaction the network refused.
+type Rejection struct {
+	Reference string
+	OrderID   string
+	Reason    string
+	At        time.Time
+}
+
+// TxStats is a summary of the transactions sent by the bot.
+type TxStats struct {
+	Sent                uint64
+	Confirmed           uint64
+	Failed              uint64
+	RejectedOrders      uint64
+	ConsecutiveFailures int
+	BackoffUntil        time.Time
+	PendingTransactions int
+	RecentRejections    []Rejection
+}
+
+type trackedTx struct {
+	sentAt time.Time
+	// number of orders we expect to see for this transaction
+	expected int
+	seen     int
+	// map[orderID]struct{}, only the first update of an order counts
+	orders map[string]struct{}
+}
+
+// TxTracker correlates the transactions we send to the network
+// with the orders updates received from the data node, using the
+// order reference. It also keeps the intent behind every order
+// reference so fills and rejections can be attributed to a quote level.
+type TxTracker struct {
+	mu sync.Mutex
+
+	// consecutive failures before we start backing off
+	threshold int
+
+	// map[batchReference]trackedTx
+	pending map[string]*trackedTx
+
+	// map[orderReference]OrderIntent
+	intents map[string]*OrderIntent
+	// batch references in order of submission, used
+	// to evict the oldest intents
+	batches []string
+	// map[side-level]LevelStats
+	levels map[string]*LevelStats
+
+	sent           uint64
+	confirmed      uint64
+	failed         uint64
+	rejectedOrders uint64
+
+	consecutiveFailures int
+	backoff             time.Duration
+	backoffUntil        time.Time
+
+	recentRejections []Rejection
+}
+
+func NewTxTracker(threshold int) *TxTracker {
+	return &TxTracker{
+		threshold: threshold,
+		pending:   map[string]*trackedTx{},
+		intents:   map[string]*OrderIntent{},
+		levels:    map[string]*LevelStats{},
+	}
+}
+
+// Track registers a transaction about to be sent with the intent of
+// each of its orders, the parts of a split batch add up to the same batch.
+func (t *TxTracker) Track(batch string, intents []*OrderIntent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sent++
+	if len(intents) <= 0 {
+		return
+	}
+
+	tx, ok := t.pending[batch]
+	if !ok {
+		tx = &trackedTx{orders: map[string]struct{}{}}
+		t.pending[batch] = tx
+	}
+	tx.sentAt = time.Now()
+	tx.expected += len(intents)
+
+	for _, i := range intents {
+		t.intents[i.Reference] = i
+		t.level(i.Side, i.Level).Orders++
+	}
+
+	if slices.Contains(t.batches, batch) {
+		return
+	}
+	t.batches = append(t.batches, batch)
+	if len(t.batches) > maxTrackedBatches {
+		evicted := t.batches[0]
+		t.batches = t.batches[1:]
+		for ref, i := range t.intents {
+			if i.Batch == evicted {
+				delete(t.intents, ref)
+			}
+		}
+	}
+}
+
+// Intent returns what the strategy meant to do with
+// the order with the given reference, if still known.
+func (t *TxTracker) Intent(reference string) (OrderIntent, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	i, ok := t.intents[reference]
+	if !ok {
+		return OrderIntent{}, false
+	}
+	return *i, true
+}
+
+// LevelStats returns the orders and fills statistics per quote level.
+func (t *TxTracker) LevelStats() []LevelStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make([]LevelStats, 0, len(t.levels))
+	for _, l := range t.levels {
+		out = append(out, *l)
+	}
+	slices.SortFunc(out, func(a, b LevelStats) bool {
+		if a.Side != b.Side {
+			return a.Side < b.Side
+		}
+		return a.Level < b.Level
+	})
+	return out
+}
+
+// Failed records a transaction which could not be sent at all.
+func (t *TxTracker) Failed(batch string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.pending, batch)
+	t.failed++
+	t.addRejection(Rejection{
+		Reference: batch,
+		Reason:    err.Error(),
+		At:        time.Now(),
+	})
+	t.onFailure()
+}
+
+// OnOrders processes orders updates from the data node, matching them
+// with the pending transactions.
+func (t *TxTracker) OnOrders(orders []*vegapb.Order) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, o := range orders {
+		if intent, ok := t.intents[o.Reference]; ok {
+			t.attributeFill(intent, o)
+		}
+
+		batch, _, _, ok := parseOrderReference(o.Reference)
+		if !ok {
+			continue
+		}
+		tx, ok := t.pending[batch]
+		if !ok {
+			continue
+		}
+
+		// later updates of the order, e.g. fills or
+		// cancellations, say nothing about the transaction
+		if _, ok := tx.orders[o.Id]; ok {
+			continue
+		}
+		tx.orders[o.Id] = struct{}{}
+		tx.seen++
+
+		switch o.Status {
+		case vegapb.Order_STATUS_REJECTED:
+			t.rejectedOrders++
+			t.addRejection(Rejection{
+				Reference: o.Reference,
+				OrderID:   o.Id,
+				Reason:    o.GetReason().String(),
+				At:        time.Now(),
+			})
+			if intent, ok := t.intents[o.Reference]; ok {
+				t.level(intent.Side, intent.Level).Rejected++
+			}
+			log.Printf("order rejected: reference(%v) reason(%v)", o.Reference, o.GetReason().String())
+			t.onFailure()
+		case vegapb.Order_STATUS_ACTIVE,
+			vegapb.Order_STATUS_FILLED,
+			vegapb.Order_STATUS_PARTIALLY_FILLED:
+			t.onSuccess()
+		}
+
+		if tx.seen >= tx.expected {
+			delete(t.pending, batch)
+			t.confirmed++
+		}
+	}
+}
+
+func (t *TxTracker) attributeFill(intent *OrderIntent, o *vegapb.Order) {
+	if o.Remaining > o.Size {
+		return
+	}
+
+	filled := o.Size - o.Remaining
+	if filled <= intent.Filled {
+		return
+	}
+
+	size := filled - intent.Filled
+	intent.Filled = filled
+
+	stats := t.level(intent.Side, intent.Level)
+	stats.Fills++
+	stats.FilledSize += size
+
+	log.Printf("fill on %v level %v: size(%v) price(%v) batch(%v) order(%v)",
+		intent.Side, intent.Level, size, o.Price, intent.Batch, o.Id)
+}
+
+func (t *TxTracker) level(side string, level int) *LevelStats {
+	key := levelKey(side, level)
+	l, ok := t.levels[key]
+	if !ok {
+		l = &LevelStats{Side: side, Level: level}
+		t.levels[key] = l
+	}
+	return l
+}
+
+// Expire fails all the transactions for which we haven't received
+// any orders in time, these most likely never made it into a block.
+func (t *TxTracker) Expire() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for ref, tx := range t.pending {
+		if now.Sub(tx.sentAt) < txConfirmationTimeout {
+			continue
+		}
+
+		delete(t.pending, ref)
+		if tx.seen > 0 {
+			// partially seen, the rest of the orders most likely
+			// were filled or cancelled before we received them
+			t.confirmed++
+			continue
+		}
+
+		log.Printf("transaction not confirmed after %v: reference(%v)", txConfirmationTimeout, ref)
+		t.failed++
+		t.addRejection(Rejection{
+			Reference: ref,
+			Reason:    "transaction not confirmed",
+			At:        now,
+		})
+		t.onFailure()
+	}
+}
+
+// Backoff returns for how long we should stop sending transactions.
+func (t *TxTracker) Backoff() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if d := time.Until(t.backoffUntil); d > 0 {
+		return d
+	}
+	return 0
+}
+
+func (t *TxTracker) Stats() TxStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return TxStats{
+		Sent:                t.sent,
+		Confirmed:           t.confirmed,
+		Failed:              t.failed,
+		RejectedOrders:      t.rejectedOrders,
+		ConsecutiveFailures: t.consecutiveFailures,
+		BackoffUntil:        t.backoffUntil,
+		PendingTransactions: len(t.pending),
+		RecentRejections:    slices.Clone(t.recentRejections),
+	}
+}
+
+func (t *TxTracker) addRejection(r Rejection) {
+	t.recentRejections = append(t.recentRejections, r)
+	if len(t.recentRejections) > maxRecentRejections {
+		t.recentRejections = t.recentRejections[len(t.recentRejections)-maxRecentRejections:]
+	}
+}
+
+func (t *TxTracker) onSuccess() {
+	t.consecutiveFailures = 0
+	t.backoff = 0
+}
+
+func (t *TxTracker) onFailure() {
+	t.consecutiveFailures++
+	if t.threshold <= 0 || t.consecutiveFailures < t.threshold {
+		return
+	}
+
+	if t.backoff <= 0 {
+		t.backoff = minRejectionBackoff
+	} else if t.backoff < maxRejectionBackoff {
+		t.backoff *= 2
+		if t.backoff > maxRejectionBackoff {
+			t.backoff = maxRejectionBackoff
+		}
+	}
+	t.backoffUntil = time.Now().Add(t.backoff)
+
+	log.Printf("ALERT: %v consecutive transaction failures, backing off for %v", t.consecutiveFailures, t.backoff)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	vegapb "code.vegaprotocol.io/vega/protos/vega"
+)
+
+// validateMarket makes sure the bot can trade the market before starting,
+// the store must be loaded already.
+func validateMarket(config *Config, vega *VegaStore) error {
+	mkt := vega.GetMarket()
+	if mkt == nil {
+		return errors.New("market not found")
+	}
+
+	if state := mkt.GetState(); state != vegapb.Market_STATE_ACTIVE {
+		return fmt.Errorf("market is in state %v, it must be active, restart the bot once the market trades", state.String())
+	}
+
+	instrument := mkt.GetTradableInstrument().GetInstrument()
+	if instrument.GetFuture() == nil && instrument.GetPerpetual() == nil && instrument.GetSpot() == nil {
+		return fmt.Errorf("instrument %v is not supported, only futures, perpetuals and spots are", instrument.GetName())
+	}
+
+	assetID := getSettlementAsset(mkt)
+	asset := vega.GetAsset(assetID)
+	if asset == nil {
+		return fmt.Errorf("settlement asset %v not found", assetID)
+	}
+
+	balance := getAssetBalance(vega, config.WalletPubkey, config.VegaMarket)
+
+	// on spot markets, owning only the base asset is enough to sell
+	if baseID := getBaseAsset(mkt); len(baseID) > 0 {
+		base := vega.GetAsset(baseID)
+		if base == nil {
+			return fmt.Errorf("base asset %v not found", baseID)
+		}
+		balance = balance.Add(getPubkeyBalance(vega, config.WalletPubkey, baseID, 0))
+		if !balance.IsPositive() {
+			return fmt.Errorf("no %v or %v funds for key %v, please deposit on its general account first",
+				base.Details.Symbol, asset.Details.Symbol, config.WalletPubkey)
+		}
+		return nil
+	}
+
+	if !balance.IsPositive() {
+		return fmt.Errorf("no %v funds for key %v, please deposit on its general account first",
+			asset.Details.Symbol, config.WalletPubkey)
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"sync"
 	"time"
@@ -9,12 +10,30 @@ import (
 	"code.vegaprotocol.io/vega/libs/ptr"
 	apipb "code.vegaprotocol.io/vega/protos/data-node/api/v2"
 	vegapb "code.vegaprotocol.io/vega/protos/vega"
+	"github.com/shopspring/decimal"
 	"golang.org/x/exp/maps"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"golang.org/x/exp/slices"
 	"google.golang.org/protobuf/proto"
 )
 
+const (
+	// header set by the data node on all responses
+	blockHeightHeader = "x-block-height"
+
+	netParamSpamPoWNumberOfTxPerBlock = "spam.pow.numberOfTxPerBlock"
+	netParamSpamMaxBatchSize          = "spam.protection.max.batchSize"
+	netParamStakeToCcyVolume          = "market.liquidity.stakeToCcyVolume"
+	netParamMinLpStakeQuantumMultiple = "market.liquidityProvision.minLpStakeQuantumMultiple"
+)
+
+// network parameters loaded at startup
+var networkParameterKeys = []string{
+	netParamSpamPoWNumberOfTxPerBlock,
+	netParamSpamMaxBatchSize,
+	netParamStakeToCcyVolume,
+	netParamMinLpStakeQuantumMultiple,
+}
+
 type VegaStore struct {
 	mu sync.RWMutex
 
@@ -24,6 +43,11 @@ type VegaStore struct {
 	marketData *vegapb.MarketData
 	// the liquidityProvision for this pubkey
 	liquidityProvision *vegapb.LiquidityProvision
+	// a submission or amendment of our liquidity
+	// provision waiting for the next epoch
+	pendingLiquidityProvision *vegapb.LiquidityProvision
+	// all the live liquidity provisions of the market
+	marketLiquidityProvisions []*vegapb.LiquidityProvision
 	// our pubkey accounts
 	// map[type+asset+market]Account
 	accounts map[string]*apipb.AccountBalance
@@ -34,14 +58,82 @@ type VegaStore struct {
 	position *vegapb.Position
 	// assets
 	assets map[string]*vegapb.Asset
+	// network parameters used by the bot
+	// map[key]value
+	networkParameters map[string]string
+	// streams which failed and are not resynced yet
+	// map[stream]struct{}
+	stale map[string]struct{}
+	// our most recent trades
+	fills *fillHistory
+	// the vega order book of the market
+	depth *l2Book
+	// last completed funding periods of a perpetual market, oldest first
+	fundingPeriods []FundingPeriod
 }
 
 func NewVegaStore() *VegaStore {
 	return &VegaStore{
-		accounts: map[string]*apipb.AccountBalance{},
-		orders:   map[string]*vegapb.Order{},
-		assets:   map[string]*vegapb.Asset{},
+		accounts:          map[string]*apipb.AccountBalance{},
+		orders:            map[string]*vegapb.Order{},
+		assets:            map[string]*vegapb.Asset{},
+		networkParameters: map[string]string{},
+		stale:             map[string]struct{}{},
+		fills:             newFillHistory(),
+		depth:             newL2Book(0, nil, nil),
+	}
+}
+
+func (v *VegaStore) SetStale(stream string, stale bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if stale {
+		v.stale[stream] = struct{}{}
+	} else {
+		delete(v.stale, stream)
+	}
+}
+
+// GetStale returns the streams for which the data is not up to date,
+// no decisions should be made on the store content until it's empty.
+func (v *VegaStore) GetStale() []string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return maps.Keys(v.stale)
+}
+
+func (v *VegaStore) SetNetworkParameter(key, value string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.networkParameters[key] = value
+}
+
+func (v *VegaStore) GetNetworkParameter(key string) (string, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	value, ok := v.networkParameters[key]
+	return value, ok
+}
+
+// GetDataLag returns how far behind the wall clock the data node is,
+// based on the vega time and on the timestamp of the last market data.
+// The one lagging the most is returned, zero if none are known yet.
+func (v *VegaStore) GetDataLag(now, vegaTime time.Time) time.Duration {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	var lag time.Duration
+	if !vegaTime.IsZero() {
+		lag = now.Sub(vegaTime)
+	}
+	if ts := v.marketData.GetTimestamp(); ts > 0 {
+		if l := now.Sub(time.Unix(0, ts)); l > lag {
+			lag = l
+		}
 	}
+
+	return lag
 }
 
 func (v *VegaStore) SetAsset(asset *vegapb.Asset) {
@@ -70,11 +162,73 @@ func (v *VegaStore) SetMarket(market *vegapb.Market) {
 	v.market = market
 }
 
-func (v *VegaStore) SetLiquidityProvision(lp *vegapb.LiquidityProvision) {
+// UpdateLiquidityProvision applies an update of our liquidity provision.
+// Submissions and amendments are pending until the next epoch, so we keep
+// them apart from the provision currently in place.
+func (v *VegaStore) UpdateLiquidityProvision(lp *vegapb.LiquidityProvision) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.updateLiquidityProvision(lp)
+}
+
+func (v *VegaStore) updateLiquidityProvision(lp *vegapb.LiquidityProvision) {
+	switch lp.Status {
+	case vegapb.LiquidityProvision_STATUS_PENDING:
+		v.pendingLiquidityProvision = lp
+	case vegapb.LiquidityProvision_STATUS_ACTIVE,
+		vegapb.LiquidityProvision_STATUS_UNDEPLOYED:
+		v.liquidityProvision = lp
+		v.pendingLiquidityProvision = nil
+	case vegapb.LiquidityProvision_STATUS_REJECTED:
+		// a rejected amendment leaves the current provision in place
+		if v.pendingLiquidityProvision != nil {
+			v.pendingLiquidityProvision = nil
+		} else {
+			v.liquidityProvision = nil
+		}
+	default:
+		// cancelled or stopped
+		v.liquidityProvision = nil
+		v.pendingLiquidityProvision = nil
+	}
+}
+
+// ResetLiquidityProvisions replaces our liquidity provisions with the live
+// ones loaded from the data node, which come in no particular order.
+func (v *VegaStore) ResetLiquidityProvisions(lps []*vegapb.LiquidityProvision) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.liquidityProvision = nil
+	v.pendingLiquidityProvision = nil
+	for _, lp := range lps {
+		switch lp.Status {
+		case vegapb.LiquidityProvision_STATUS_PENDING:
+			v.pendingLiquidityProvision = lp
+		case vegapb.LiquidityProvision_STATUS_ACTIVE,
+			vegapb.LiquidityProvision_STATUS_UNDEPLOYED:
+			v.liquidityProvision = lp
+		}
+	}
+}
+
+func (v *VegaStore) GetPendingLiquidityProvision() *vegapb.LiquidityProvision {
 	v.mu.RLock()
 	defer v.mu.RUnlock()
+	return proto.Clone(v.pendingLiquidityProvision).(*vegapb.LiquidityProvision)
+}
 
-	v.liquidityProvision = lp
+func (v *VegaStore) SetMarketLiquidityProvisions(lps []*vegapb.LiquidityProvision) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.marketLiquidityProvisions = lps
+}
+
+func (v *VegaStore) GetMarketLiquidityProvisions() []*vegapb.LiquidityProvision {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return slices.Clone(v.marketLiquidityProvisions)
 }
 
 func (v *VegaStore) GetMarket() *vegapb.Market {
@@ -111,7 +265,10 @@ func (v *VegaStore) GetPosition() *vegapb.Position {
 func (v *VegaStore) SetOrders(orders []*vegapb.Order) {
 	v.mu.Lock()
 	defer v.mu.Unlock()
+	v.setOrders(orders)
+}
 
+func (v *VegaStore) setOrders(orders []*vegapb.Order) {
 	for _, o := range orders {
 		if o.Status != vegapb.Order_STATUS_ACTIVE {
 			delete(v.orders, o.Id)
@@ -122,6 +279,82 @@ func (v *VegaStore) SetOrders(orders []*vegapb.Order) {
 	}
 }
 
+// ResetOrders replaces all our orders with the given ones.
+func (v *VegaStore) ResetOrders(orders []*vegapb.Order) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.orders = map[string]*vegapb.Order{}
+	v.setOrders(orders)
+}
+
+func (v *VegaStore) SetFundingPeriods(periods []FundingPeriod) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.fundingPeriods = periods
+}
+
+func (v *VegaStore) GetFundingPeriods() []FundingPeriod {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return slices.Clone(v.fundingPeriods)
+}
+
+// ResetMarketDepth replaces the book with the given snapshot.
+func (v *VegaStore) ResetMarketDepth(sequence uint64, buy, sell []*vegapb.PriceLevel) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.depth = newL2Book(sequence, buy, sell)
+}
+
+// UpdateMarketDepth applies the updates to the book, it fails
+// if an update is missing and the book must be reloaded.
+func (v *VegaStore) UpdateMarketDepth(updates []*vegapb.MarketDepthUpdate) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for _, u := range updates {
+		if err := v.depth.apply(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetMarketDepth returns up to depth levels per side of the
+// book, all of them if depth is 0.
+func (v *VegaStore) GetMarketDepth(depth int) Book {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.depth.snapshot(depth)
+}
+
+func (v *VegaStore) AddFills(fills []Fill) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, f := range fills {
+		v.fills.add(f)
+	}
+}
+
+// ResetFills replaces all our fills with the given ones.
+func (v *VegaStore) ResetFills(fills []Fill) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.fills = newFillHistory()
+	for _, f := range fills {
+		v.fills.add(f)
+	}
+}
+
+// GetFills returns our most recent fills, oldest first.
+func (v *VegaStore) GetFills() []Fill {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.fills.list()
+}
+
 func (v *VegaStore) GetOrder(id string) *vegapb.Order {
 	v.mu.RLock()
 	defer v.mu.RUnlock()
@@ -162,90 +395,197 @@ func (v *VegaStore) GetLiquidityProvison() *vegapb.LiquidityProvision {
 }
 
 type vegaAPI struct {
-	config *Config
-	store  *VegaStore
-	svc    apipb.TradingDataServiceClient
+	config  *Config
+	store   *VegaStore
+	tracker *TxTracker
+	nodes   *DataNodePool
 }
 
-func VegaAPI(config *Config, store *VegaStore) {
-	conn, err := grpc.Dial(config.VegaGRPCURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		log.Fatalf("could not open connection with vega node: %v", err)
-	}
-
-	svc := apipb.NewTradingDataServiceClient(conn)
+// svc returns the client of the data node currently in use.
+func (v *vegaAPI) svc() apipb.TradingDataServiceClient {
+	svc, _ := v.nodes.Client()
+	return svc
+}
 
+func VegaAPI(
+	config *Config,
+	nodes *DataNodePool,
+	store *VegaStore,
+	tracker *TxTracker,
+) {
 	api := &vegaAPI{
-		config: config,
-		svc:    svc,
-		store:  store,
+		config:  config,
+		nodes:   nodes,
+		store:   store,
+		tracker: tracker,
 	}
 
 	// now populate initial data
-	api.loadMarket()
-	api.loadMarketData()
-	api.loadAccounts()
-	api.loadOrders()
-	api.loadPosition()
-	api.loadAssets()
-	api.loadLP()
+	for _, load := range []func() error{
+		api.loadMarket,
+		api.loadMarketData,
+		api.loadAccounts,
+		api.loadOrders,
+		api.loadPosition,
+		api.loadAssets,
+		api.loadLP,
+		api.loadTrades,
+		api.loadMarketDepth,
+	} {
+		if err := load(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if lps, err := loadMarketLPs(nodes, config.VegaMarket); err != nil {
+		log.Printf("could not load market liquidity provisions: %v", err)
+	} else {
+		store.SetMarketLiquidityProvisions(lps)
+	}
+	api.loadNetworkParameters()
 
 	go func() {
 		// then we start our streams
-		go api.streamMarketData()
-		go api.streamAccounts()
-		go api.streamOrders()
-		go api.streamPosition()
-		go api.streamLP()
+		go api.supervise("market data", api.streamMarketData, api.loadMarketData)
+		go api.supervise("accounts", api.streamAccounts, api.loadAccounts)
+		go api.supervise("orders", api.streamOrders, api.loadOrders)
+		go api.supervise("position", api.streamPosition, api.loadPosition)
+		go api.supervise("liquidity provision", api.streamLP, api.loadLP)
+		go api.supervise("trades", api.streamTrades, api.loadTrades)
+		// the depth stream reloads the book itself every time it is opened
+		go api.supervise("market depth", api.streamMarketDepth, func() error { return nil })
+		go api.streamFundingPeriods()
 	}()
 
 	return
 }
 
-func (v *vegaAPI) loadLP() {
-	resp, err := v.svc.ListLiquidityProvisions(context.Background(), &apipb.ListLiquidityProvisionsRequest{
+func (v *vegaAPI) loadLP() error {
+	resp, err := v.svc().ListLiquidityProvisions(context.Background(), &apipb.ListLiquidityProvisionsRequest{
 		MarketId: ptr.From(v.config.VegaMarket),
 		PartyId:  ptr.From(v.config.WalletPubkey),
 		Live:     ptr.From(true),
 	})
+	if err != nil {
+		return fmt.Errorf("could not load liquidity provision: %w", err)
+	}
+
+	lps := []*vegapb.LiquidityProvision{}
+	for _, e := range resp.LiquidityProvisions.Edges {
+		lps = append(lps, e.Node)
+	}
+
+	v.store.ResetLiquidityProvisions(lps)
+	return nil
+}
 
+func (v *vegaAPI) streamLP(resync func() error) error {
+	svc, ctx := v.nodes.Client()
+	stream, err := svc.ObserveLiquidityProvisions(ctx, &apipb.ObserveLiquidityProvisionsRequest{
+		MarketId: ptr.From(v.config.VegaMarket),
+		PartyId:  ptr.From(v.config.WalletPubkey),
+	})
 	if err != nil {
-		log.Printf("could not load liquidity provision: %v", err)
+		return fmt.Errorf("could not start liquidity provisions stream: %w", err)
 	}
 
-	if len(resp.LiquidityProvisions.Edges) > 0 {
-		v.store.SetLiquidityProvision(resp.LiquidityProvisions.Edges[0].Node)
+	if err := resync(); err != nil {
+		return err
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			return fmt.Errorf("could not recv liquidity provisions: %w", err)
+		}
+
+		for _, lp := range resp.LiquidityProvisions {
+			v.store.UpdateLiquidityProvision(lp)
+		}
 	}
 }
 
-func (v *vegaAPI) streamLP() {
-	for range time.NewTicker(5 * time.Second).C {
-		resp, err := v.svc.ListLiquidityProvisions(context.Background(), &apipb.ListLiquidityProvisionsRequest{
-			MarketId: ptr.From(v.config.VegaMarket),
-			PartyId:  ptr.From(v.config.WalletPubkey),
-			Live:     ptr.From(true),
-		})
+func (v *vegaAPI) loadNetworkParameters() {
+	for _, key := range networkParameterKeys {
+		resp, err := v.svc().GetNetworkParameter(context.Background(), &apipb.GetNetworkParameterRequest{Key: key})
 		if err != nil {
-			log.Printf("could not load liquidity provision: %v", err)
+			log.Printf("could not load network parameter %v: %v", key, err)
 			continue
 		}
 
-		if len(resp.LiquidityProvisions.Edges) > 0 {
-			v.store.SetLiquidityProvision(resp.LiquidityProvisions.Edges[0].Node)
+		v.store.SetNetworkParameter(key, resp.NetworkParameter.Value)
+	}
+}
+
+// streamFundingPeriods periodically loads the last
+// completed funding periods of a perpetual market.
+func (v *vegaAPI) streamFundingPeriods() {
+	load := func() {
+		if v.store.GetMarket().GetTradableInstrument().GetInstrument().GetPerpetual() == nil {
+			return
+		}
+
+		resp, err := v.svc().ListFundingPeriods(context.Background(), &apipb.ListFundingPeriodsRequest{
+			MarketId: v.config.VegaMarket,
+			Pagination: &apipb.Pagination{
+				First:       ptr.From(int32(maxFundingPeriods + 1)),
+				NewestFirst: ptr.From(true),
+			},
+		})
+		if err != nil {
+			log.Printf("could not load funding periods: %v", err)
+			return
+		}
+
+		periods := []FundingPeriod{}
+		for _, e := range resp.FundingPeriods.Edges {
+			// the current period is not over yet
+			if e.Node.End == nil {
+				continue
+			}
+
+			rate, err := decimal.NewFromString(e.Node.GetFundingRate())
+			if err != nil {
+				continue
+			}
+
+			periods = append(periods, FundingPeriod{
+				Seq:   e.Node.Seq,
+				Start: time.Unix(0, e.Node.Start),
+				End:   time.Unix(0, e.Node.GetEnd()),
+				Rate:  rate,
+			})
 		}
+
+		slices.SortFunc(periods, func(a, b FundingPeriod) bool {
+			return a.Seq < b.Seq
+		})
+		if len(periods) > maxFundingPeriods {
+			periods = periods[len(periods)-maxFundingPeriods:]
+		}
+		v.store.SetFundingPeriods(periods)
+	}
+
+	load()
+	for range time.NewTicker(time.Minute).C {
+		load()
 	}
 }
 
-func (v *vegaAPI) streamMarketData() {
-	stream, err := v.svc.ObserveMarketsData(context.Background(), &apipb.ObserveMarketsDataRequest{MarketIds: []string{v.config.VegaMarket}})
+func (v *vegaAPI) streamMarketData(resync func() error) error {
+	svc, ctx := v.nodes.Client()
+	stream, err := svc.ObserveMarketsData(ctx, &apipb.ObserveMarketsDataRequest{MarketIds: []string{v.config.VegaMarket}})
 	if err != nil {
-		log.Fatalf("could not start market data stream: %v", err)
+		return fmt.Errorf("could not start market data stream: %w", err)
+	}
+
+	if err := resync(); err != nil {
+		return err
 	}
 
 	for {
 		resp, err := stream.Recv()
 		if err != nil {
-			log.Fatalf("could not recv market data: %v", err)
+			return fmt.Errorf("could not recv market data: %w", err)
 		}
 
 		for _, md := range resp.MarketData {
@@ -254,37 +594,51 @@ func (v *vegaAPI) streamMarketData() {
 	}
 }
 
-func (v *vegaAPI) streamPosition() {
-	stream, err := v.svc.ObservePositions(context.Background(), &apipb.ObservePositionsRequest{MarketId: ptr.From(v.config.VegaMarket), PartyId: ptr.From(v.config.WalletPubkey)})
+func (v *vegaAPI) streamPosition(resync func() error) error {
+	svc, ctx := v.nodes.Client()
+	stream, err := svc.ObservePositions(ctx, &apipb.ObservePositionsRequest{MarketId: ptr.From(v.config.VegaMarket), PartyId: ptr.From(v.config.WalletPubkey)})
 	if err != nil {
-		log.Fatalf("could not start market data stream: %v", err)
+		return fmt.Errorf("could not start positions stream: %w", err)
+	}
+
+	if err := resync(); err != nil {
+		return err
 	}
 
 	for {
 		resp, err := stream.Recv()
 		if err != nil {
-			log.Fatalf("could not recv market data: %v", err)
+			return fmt.Errorf("could not recv positions: %w", err)
 		}
 
 		switch r := resp.Response.(type) {
 		case *apipb.ObservePositionsResponse_Snapshot:
-			v.store.SetPosition(r.Snapshot.Positions[0])
+			if len(r.Snapshot.Positions) > 0 {
+				v.store.SetPosition(r.Snapshot.Positions[0])
+			}
 		case *apipb.ObservePositionsResponse_Updates:
-			v.store.SetPosition(r.Updates.Positions[0])
+			if len(r.Updates.Positions) > 0 {
+				v.store.SetPosition(r.Updates.Positions[0])
+			}
 		}
 	}
 }
 
-func (v *vegaAPI) streamOrders() {
-	stream, err := v.svc.ObserveOrders(context.Background(), &apipb.ObserveOrdersRequest{MarketIds: []string{v.config.VegaMarket}, PartyIds: []string{v.config.WalletPubkey}})
+func (v *vegaAPI) streamOrders(resync func() error) error {
+	svc, ctx := v.nodes.Client()
+	stream, err := svc.ObserveOrders(ctx, &apipb.ObserveOrdersRequest{MarketIds: []string{v.config.VegaMarket}, PartyIds: []string{v.config.WalletPubkey}})
 	if err != nil {
-		log.Fatalf("could not start market data stream: %v", err)
+		return fmt.Errorf("could not start orders stream: %w", err)
+	}
+
+	if err := resync(); err != nil {
+		return err
 	}
 
 	for {
 		resp, err := stream.Recv()
 		if err != nil {
-			log.Fatalf("could not recv market data: %v", err)
+			return fmt.Errorf("could not recv orders: %w", err)
 		}
 
 		switch r := resp.Response.(type) {
@@ -292,20 +646,91 @@ func (v *vegaAPI) streamOrders() {
 			v.store.SetOrders(r.Snapshot.Orders)
 		case *apipb.ObserveOrdersResponse_Updates:
 			v.store.SetOrders(r.Updates.Orders)
+			v.tracker.OnOrders(r.Updates.Orders)
 		}
 	}
 }
 
-func (v *vegaAPI) streamAccounts() {
-	stream, err := v.svc.ObserveAccounts(context.Background(), &apipb.ObserveAccountsRequest{PartyId: v.config.WalletPubkey})
+func (v *vegaAPI) streamMarketDepth(resync func() error) error {
+	svc, ctx := v.nodes.Client()
+	stream, err := svc.ObserveMarketsDepthUpdates(ctx, &apipb.ObserveMarketsDepthUpdatesRequest{MarketIds: []string{v.config.VegaMarket}})
 	if err != nil {
-		log.Fatalf("could not start market data stream: %v", err)
+		return fmt.Errorf("could not start market depth stream: %w", err)
+	}
+
+	// the snapshot must be taken once subscribed, even on the first
+	// open, otherwise the updates sent in between are a sequence gap
+	if err := v.loadMarketDepth(); err != nil {
+		return err
+	}
+	if err := resync(); err != nil {
+		return err
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			return fmt.Errorf("could not recv market depth: %w", err)
+		}
+
+		// on a gap the stream is restarted and the book reloaded
+		if err := v.store.UpdateMarketDepth(resp.Update); err != nil {
+			return err
+		}
+	}
+}
+
+func (v *vegaAPI) streamTrades(resync func() error) error {
+	svc, ctx := v.nodes.Client()
+	stream, err := svc.ObserveTrades(ctx, &apipb.ObserveTradesRequest{MarketIds: []string{v.config.VegaMarket}, PartyIds: []string{v.config.WalletPubkey}})
+	if err != nil {
+		return fmt.Errorf("could not start trades stream: %w", err)
+	}
+
+	if err := resync(); err != nil {
+		return err
 	}
 
 	for {
 		resp, err := stream.Recv()
 		if err != nil {
-			log.Fatalf("could not recv market data: %v", err)
+			return fmt.Errorf("could not recv trades: %w", err)
+		}
+
+		v.store.AddFills(v.toFills(resp.Trades))
+	}
+}
+
+// toFills returns our side of the trades, oldest first.
+func (v *vegaAPI) toFills(trades []*vegapb.Trade) []Fill {
+	fills := []Fill{}
+	for _, t := range trades {
+		if f, ok := newFill(v.config.WalletPubkey, t); ok {
+			fills = append(fills, f)
+		}
+	}
+
+	slices.SortStableFunc(fills, func(a, b Fill) bool {
+		return a.Timestamp.Before(b.Timestamp)
+	})
+	return fills
+}
+
+func (v *vegaAPI) streamAccounts(resync func() error) error {
+	svc, ctx := v.nodes.Client()
+	stream, err := svc.ObserveAccounts(ctx, &apipb.ObserveAccountsRequest{PartyId: v.config.WalletPubkey})
+	if err != nil {
+		return fmt.Errorf("could not start accounts stream: %w", err)
+	}
+
+	if err := resync(); err != nil {
+		return err
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			return fmt.Errorf("could not recv accounts: %w", err)
 		}
 
 		switch r := resp.Response.(type) {
@@ -317,39 +742,52 @@ func (v *vegaAPI) streamAccounts() {
 	}
 }
 
-func (v *vegaAPI) loadMarket() {
-	resp, err := v.svc.GetMarket(context.Background(), &apipb.GetMarketRequest{MarketId: v.config.VegaMarket})
+func (v *vegaAPI) loadMarket() error {
+	resp, err := v.svc().GetMarket(context.Background(), &apipb.GetMarketRequest{MarketId: v.config.VegaMarket})
 	if err != nil {
-		log.Fatalf("couldn't load the vega market: %v", err)
+		return fmt.Errorf("couldn't load the vega market: %w", err)
 	}
 
 	v.store.SetMarket(resp.Market)
+	return nil
 }
 
-func (v *vegaAPI) loadMarketData() {
-	resp, err := v.svc.GetLatestMarketData(context.Background(), &apipb.GetLatestMarketDataRequest{MarketId: v.config.VegaMarket})
+func (v *vegaAPI) loadMarketData() error {
+	resp, err := v.svc().GetLatestMarketData(context.Background(), &apipb.GetLatestMarketDataRequest{MarketId: v.config.VegaMarket})
 	if err != nil {
-		log.Fatalf("couldn't load the vega market: %v", err)
+		return fmt.Errorf("couldn't load the market data: %w", err)
 	}
 
 	v.store.SetMarketData(resp.MarketData)
+	return nil
 }
 
-func (v *vegaAPI) loadAssets() {
-	resp, err := v.svc.ListAssets(context.Background(), &apipb.ListAssetsRequest{})
+func (v *vegaAPI) loadMarketDepth() error {
+	resp, err := v.svc().GetLatestMarketDepth(context.Background(), &apipb.GetLatestMarketDepthRequest{MarketId: v.config.VegaMarket})
 	if err != nil {
-		log.Fatalf("couldn't load the vega market: %v", err)
+		return fmt.Errorf("couldn't load the market depth: %w", err)
+	}
+
+	v.store.ResetMarketDepth(resp.SequenceNumber, resp.Buy, resp.Sell)
+	return nil
+}
+
+func (v *vegaAPI) loadAssets() error {
+	resp, err := v.svc().ListAssets(context.Background(), &apipb.ListAssetsRequest{})
+	if err != nil {
+		return fmt.Errorf("couldn't load the assets: %w", err)
 	}
 
 	for _, a := range resp.Assets.Edges {
 		v.store.SetAsset(a.Node)
 	}
+	return nil
 }
 
-func (v *vegaAPI) loadAccounts() {
-	resp, err := v.svc.ListAccounts(context.Background(), &apipb.ListAccountsRequest{Filter: &apipb.AccountFilter{PartyIds: []string{v.config.WalletPubkey}}})
+func (v *vegaAPI) loadAccounts() error {
+	resp, err := v.svc().ListAccounts(context.Background(), &apipb.ListAccountsRequest{Filter: &apipb.AccountFilter{PartyIds: []string{v.config.WalletPubkey}}})
 	if err != nil {
-		log.Fatalf("couldn't load the vega market: %v", err)
+		return fmt.Errorf("couldn't load the accounts: %w", err)
 	}
 
 	accounts := []*apipb.AccountBalance{}
@@ -358,12 +796,13 @@ func (v *vegaAPI) loadAccounts() {
 	}
 
 	v.store.SetAccounts(accounts)
+	return nil
 }
 
-func (v *vegaAPI) loadOrders() {
-	resp, err := v.svc.ListOrders(context.Background(), &apipb.ListOrdersRequest{Filter: &apipb.OrderFilter{PartyIds: []string{v.config.WalletPubkey}, MarketIds: []string{v.config.VegaMarket}, LiveOnly: ptr.From(true)}})
+func (v *vegaAPI) loadOrders() error {
+	resp, err := v.svc().ListOrders(context.Background(), &apipb.ListOrdersRequest{Filter: &apipb.OrderFilter{PartyIds: []string{v.config.WalletPubkey}, MarketIds: []string{v.config.VegaMarket}, LiveOnly: ptr.From(true)}})
 	if err != nil {
-		log.Fatalf("couldn't load the vega market: %v", err)
+		return fmt.Errorf("couldn't load the orders: %w", err)
 	}
 
 	orders := []*vegapb.Order{}
@@ -371,20 +810,48 @@ func (v *vegaAPI) loadOrders() {
 		orders = append(orders, o.Node)
 	}
 
-	v.store.SetOrders(orders)
+	// orders which stopped being live while we
+	// were not listening must be forgotten as well
+	v.store.ResetOrders(orders)
+	return nil
 }
 
-func (v *vegaAPI) loadPosition() {
-	resp, err := v.svc.ListPositions(context.Background(), &apipb.ListPositionsRequest{PartyId: v.config.WalletPubkey, MarketId: v.config.VegaMarket})
+func (v *vegaAPI) loadTrades() error {
+	resp, err := v.svc().ListTrades(context.Background(), &apipb.ListTradesRequest{
+		MarketIds: []string{v.config.VegaMarket},
+		PartyIds:  []string{v.config.WalletPubkey},
+		Pagination: &apipb.Pagination{
+			First:       ptr.From(int32(maxFills)),
+			NewestFirst: ptr.From(true),
+		},
+	})
 	if err != nil {
-		log.Fatalf("couldn't load the vega market: %v", err)
+		return fmt.Errorf("couldn't load the trades: %w", err)
 	}
 
-	if len(resp.Positions.Edges) > 1 {
-		log.Fatalf("invalid number of positions loaded: %v", len(resp.Positions.Edges))
+	trades := []*vegapb.Trade{}
+	for _, e := range resp.Trades.Edges {
+		trades = append(trades, e.Node)
+	}
+
+	v.store.ResetFills(v.toFills(trades))
+	return nil
+}
+
+func (v *vegaAPI) loadPosition() error {
+	resp, err := v.svc().ListPositions(context.Background(), &apipb.ListPositionsRequest{PartyId: v.config.WalletPubkey, MarketId: v.config.VegaMarket})
+	if err != nil {
+		return fmt.Errorf("couldn't load the position: %w", err)
 	}
 
-	if len(resp.Positions.Edges) == 1 {
+	switch len(resp.Positions.Edges) {
+	case 0:
+		// the position we had may have been closed meanwhile
+		v.store.SetPosition(nil)
+	case 1:
 		v.store.SetPosition(resp.Positions.Edges[0].Node)
+	default:
+		return fmt.Errorf("invalid number of positions loaded: %v", len(resp.Positions.Edges))
 	}
+	return nil
 }